@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"brpc/compiler"
+)
+
+// pathList collects a flag that may be repeated
+type pathList []string
+
+func (l *pathList) String() string {
+	return strings.Join(*l, string(os.PathListSeparator))
+}
+
+func (l *pathList) Set(path string) error {
+	*l = append(*l, path)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: brpc [-out dir] [-pkg name] [-I dir]... file.brpc...\n")
+	fmt.Fprintf(os.Stderr, "       brpc compat [-I dir]... old.brpc new.brpc\n")
+	fmt.Fprintf(os.Stderr, "       brpc fmt [-check] file.brpc...\n")
+	flag.PrintDefaults()
+}
+
+func printDiagnostic(diag compiler.Diagnostic) {
+	fmt.Fprintln(os.Stderr, diag)
+	fmt.Fprintln(os.Stderr, diag.Snippet())
+}
+
+// outputPath maps a schema file to the go file generated for it, e.g. game.brpc to game.brpc.go
+func outputPath(outDir string, schemaPath string) string {
+	name := strings.TrimSuffix(filepath.Base(schemaPath), ".brpc")
+	return filepath.Join(outDir, name+".brpc.go")
+}
+
+// packageName derives a package name from a directory name by dropping the characters go does not allow in one, e.g. my-gen to mygen
+func packageName(dir string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, dir)
+}
+
+// compileFiles compiles every schema before writing any output, so all diagnostics are reported at once
+func compileFiles(schemaPaths []string, outDir string, pack string, searchPaths []string) bool {
+	ok := true
+	files := make(map[string][]byte)
+	for _, schemaPath := range schemaPaths {
+		program, err := os.ReadFile(schemaPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+		files[schemaPath] = program
+	}
+
+	result, diags := compiler.Compile(files, compiler.Options{Package: pack, SearchPaths: searchPaths, ReadFile: os.ReadFile})
+	for _, diag := range diags {
+		printDiagnostic(diag)
+		if !diag.Warning {
+			ok = false
+		}
+	}
+
+	for schemaPath, output := range result.Sources {
+		if err := os.WriteFile(outputPath(outDir, schemaPath), output, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkCompat reports every change in the new schema that prevents it from reading data written by the old schema
+func checkCompat(oldPath string, newPath string, searchPaths []string) bool {
+	oldProgram, err := os.ReadFile(oldPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	newProgram, err := os.ReadFile(newPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+
+	opts := compiler.Options{SearchPaths: searchPaths, ReadFile: os.ReadFile}
+	changes, diags := compiler.CheckCompat(map[string][]byte{oldPath: oldProgram}, map[string][]byte{newPath: newProgram}, opts)
+	ok := len(changes) == 0
+	for _, diag := range diags {
+		printDiagnostic(diag)
+		if !diag.Warning {
+			ok = false
+		}
+	}
+	for _, change := range changes {
+		printDiagnostic(change)
+	}
+	return ok
+}
+
+func compatMain(args []string) {
+	flags := flag.NewFlagSet("compat", flag.ExitOnError)
+	var searchPaths pathList
+	flags.Var(&searchPaths, "I", "directory to search for imports in, after the directory of the importing file (may be repeated)")
+	flags.Usage = usage
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		usage()
+		os.Exit(2)
+	}
+	if !checkCompat(flags.Arg(0), flags.Arg(1), searchPaths) {
+		os.Exit(1)
+	}
+}
+
+// formatFiles rewrites each schema in the canonical layout, or only reports the schemas that are not when check is set
+func formatFiles(schemaPaths []string, check bool) bool {
+	ok := true
+	for _, schemaPath := range schemaPaths {
+		program, err := os.ReadFile(schemaPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+
+		output, diags := compiler.Format(schemaPath, program)
+		for _, diag := range diags {
+			printDiagnostic(diag)
+			ok = false
+		}
+		if output == nil || bytes.Equal(output, program) {
+			continue
+		}
+
+		if check {
+			fmt.Fprintf(os.Stderr, "%s is not formatted\n", schemaPath)
+			ok = false
+		} else if err := os.WriteFile(schemaPath, output, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func fmtMain(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "report schemas that are not formatted instead of rewriting them")
+	flags.Usage = usage
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if !formatFiles(flags.Args(), *check) {
+		os.Exit(1)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "compat" {
+		compatMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		fmtMain(os.Args[2:])
+		return
+	}
+
+	outDir := flag.String("out", ".", "directory to write generated go files to")
+	pack := flag.String("pkg", "", "go package name of the generated files for schemas that do not set the package property, defaults to the name of the output directory")
+	var searchPaths pathList
+	flag.Var(&searchPaths, "I", "directory to search for imports in, after the directory of the importing file (may be repeated)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	if *pack == "" {
+		absDir, err := filepath.Abs(*outDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*pack = packageName(filepath.Base(absDir))
+		if !compiler.IsPackageName(*pack) {
+			fmt.Fprintf(os.Stderr, "brpc: cannot name the go package after the output directory %q, set one with -pkg\n", *outDir)
+			os.Exit(2)
+		}
+	} else if !compiler.IsPackageName(*pack) {
+		fmt.Fprintf(os.Stderr, "brpc: %q is not a valid go package name\n", *pack)
+		os.Exit(2)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if !compileFiles(flag.Args(), *outDir, *pack, searchPaths) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package compiler
+
+import (
+	"path/filepath"
+
+	"brpc/internal"
+)
+
+// analyze validates each schema in files, returning the nodes of each keyed by path
+func (l *loader) analyze(diags []Diagnostic) (internal.ImportTable, []Diagnostic) {
+	table := make(internal.ImportTable)
+	for _, path := range l.paths() {
+		var errs []error
+		table[filepath.Clean(path)] = internal.Analyze(string(l.files[path]), filepath.Clean(path), l.imp, &errs)
+		diags = l.diagnose(diags, errs, path)
+	}
+	return table, diags
+}
+
+// CheckCompat reports the changes between two versions of a set of schemas that prevent the new version from reading data written by the old version
+// definitions are matched by name across all of the schemas in each version, so a definition may move between files
+// changes are located in the new version of the schemas, unless what changed was removed, and are not reported if either version fails to compile
+// warnings about deprecated fields the new version uses again are returned with diags, as they do not prevent reading old data
+func CheckCompat(oldFiles map[string][]byte, newFiles map[string][]byte, opts Options) (changes []Diagnostic, diags []Diagnostic) {
+	oldLoader := makeLoader(oldFiles, opts)
+	newLoader := makeLoader(newFiles, opts)
+
+	oldTable, diags := oldLoader.analyze(diags)
+	newTable, diags := newLoader.analyze(diags)
+	for _, diag := range diags {
+		if !diag.Warning {
+			return nil, diags
+		}
+	}
+
+	for _, err := range internal.CheckCompat(oldTable, newTable) {
+		diag := internal.MakeDiagnostic(err, "")
+		sources := newLoader.sources
+		if diag.Old {
+			sources = oldLoader.sources
+		}
+		if diag.Warning {
+			diags = append(diags, locate(diag, sources))
+			continue
+		}
+		changes = append(changes, locate(diag, sources))
+	}
+	return changes, diags
+}
@@ -0,0 +1,174 @@
+// Package compiler generates go code from brpc schemas, so tools can embed the compiler rather than running the brpc command
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"brpc/internal"
+)
+
+type Options struct {
+	// Package is the go package name of the generated files, for schemas that do not set the package property, a schema without either is reported
+	Package string
+	// SearchPaths are the directories searched for imports, after the directory of the importing file
+	SearchPaths []string
+	// ReadFile loads imports that are not among the files being compiled, if nil imports are only resolved from those files
+	ReadFile func(path string) ([]byte, error)
+}
+
+type Result struct {
+	// Sources maps the path of each schema that compiled without errors, other than warnings, to the go source generated for it
+	Sources map[string][]byte
+}
+
+// Diagnostic is an error in a range of a schema, lines and columns start at 1 and columns count bytes
+type Diagnostic struct {
+	File      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int // the column just past the end of the range
+	Message   string
+	Source    string // the line of the schema the range begins on
+	Warning   bool   // warnings do not stop a schema from compiling
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// Snippet renders the source line of the diagnostic, underlined with carets where the range covers it
+func (d Diagnostic) Snippet() string {
+	end := len(d.Source) + 1
+	if d.EndLine == d.Line {
+		end = min(d.EndColumn, end)
+	}
+	start := min(d.Column-1, len(d.Source))
+
+	var sb strings.Builder
+	sb.WriteString(d.Source)
+	sb.WriteString("\n")
+	for _, c := range d.Source[:start] {
+		// tabs are kept so the carets line up however wide a tab is displayed
+		if c == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	sb.WriteString(strings.Repeat("^", max(end-start-1, 1)))
+	return sb.String()
+}
+
+// IsPackageName reports whether name can be the name of a go package, as Options.Package must be
+func IsPackageName(name string) bool {
+	return internal.IsPackageName(name)
+}
+
+// loader reads the schemas being compiled, then any other imports with ReadFile, keeping every source so diagnostics can be located
+type loader struct {
+	files   map[string][]byte
+	sources map[string][]byte
+	imp     *internal.Importer
+}
+
+func makeLoader(files map[string][]byte, opts Options) loader {
+	l := loader{files: files, sources: make(map[string][]byte)}
+	for path, program := range files {
+		l.sources[filepath.Clean(path)] = program
+	}
+	readFile := func(path string) ([]byte, error) {
+		if program, ok := l.sources[path]; ok {
+			return program, nil
+		}
+		if opts.ReadFile == nil {
+			return nil, os.ErrNotExist
+		}
+		program, err := opts.ReadFile(path)
+		if err == nil {
+			l.sources[path] = program
+		}
+		return program, err
+	}
+	l.imp = internal.NewImporter(opts.SearchPaths, readFile)
+	return l
+}
+
+// paths lists the schemas being compiled in order, so diagnostics are reported deterministically
+func (l *loader) paths() []string {
+	var paths []string
+	for path := range l.files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// diagnose locates the errors emitted while compiling the schema at path
+// a schema that is also imported by another schema reports its errors in both places, so duplicates are dropped
+func (l *loader) diagnose(diags []Diagnostic, errs []error, path string) []Diagnostic {
+	for _, err := range errs {
+		diag := locate(internal.MakeDiagnostic(err, filepath.Clean(path)), l.sources)
+		if !slices.Contains(diags, diag) {
+			diags = append(diags, diag)
+		}
+	}
+	return diags
+}
+
+// Compile generates the go source for each schema in files, keyed by path
+// schemas may import each other, any other imports are loaded with ReadFile
+func Compile(files map[string][]byte, opts Options) (Result, []Diagnostic) {
+	l := makeLoader(files, opts)
+
+	result := Result{Sources: make(map[string][]byte)}
+	var diags []Diagnostic
+	for _, path := range l.paths() {
+		var errs []error
+		output := internal.Compile(string(files[path]), filepath.Clean(path), opts.Package, l.imp, &errs)
+		diags = l.diagnose(diags, errs, path)
+		if !internal.HasErrors(errs) {
+			result.Sources[path] = []byte(output)
+		}
+	}
+	return result, diags
+}
+
+// locate finds the end of the range of a diagnostic and the source line it begins on, the lexer has already found where it begins
+func locate(diag internal.Diagnostic, sources map[string][]byte) Diagnostic {
+	src := string(sources[diag.Path])
+	b := min(diag.B, len(src))
+	e := min(max(diag.E, b), len(src))
+
+	line, column := diag.Line, diag.Col
+	if line == 0 {
+		// the error has no position, so it is reported at the start of the file
+		line, column = 1, 1
+	}
+	endLine := line + strings.Count(src[b:e], "\n")
+	endColumn := e - strings.LastIndex(src[:e], "\n")
+
+	lineStart := strings.LastIndex(src[:b], "\n") + 1
+	lineEnd := strings.IndexByte(src[b:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += b
+	}
+	source := strings.TrimSuffix(src[lineStart:lineEnd], "\r")
+
+	return Diagnostic{
+		File:      diag.Path,
+		Line:      line,
+		Column:    column,
+		EndLine:   endLine,
+		EndColumn: endColumn,
+		Message:   diag.Message,
+		Source:    source,
+		Warning:   diag.Warning,
+	}
+}
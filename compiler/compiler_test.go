@@ -0,0 +1,349 @@
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	files := map[string][]byte{
+		"schemas/game.brpc": []byte(`
+import "board"
+
+message Game struct {
+	required board @1 Board;
+}
+`),
+		"schemas/board.brpc": []byte(`
+message Board struct {
+	required cells @1 [64]int2;
+}
+`),
+	}
+
+	result, diags := Compile(files, Options{Package: "game"})
+
+	assert.Empty(t, diags)
+	assert.Len(t, result.Sources, 2)
+	assert.True(t, strings.HasPrefix(string(result.Sources["schemas/game.brpc"]), "// Code generated by brpc. DO NOT EDIT.\n\npackage game\n"))
+	assert.Contains(t, string(result.Sources["schemas/game.brpc"]), "Board Board\n")
+	assert.Contains(t, string(result.Sources["schemas/board.brpc"]), "type Board struct {\n")
+}
+
+func TestCompile_Diagnostics(t *testing.T) {
+	files := map[string][]byte{
+		"game.brpc": []byte(`import "board"
+
+message Game struct {
+	required board @1 Board;
+	required move @2 Move;
+}
+`),
+		"board.brpc": []byte(`message Board struct {
+	required cells @1 [64]Cell;
+}
+`),
+	}
+
+	result, diags := Compile(files, Options{Package: "game"})
+
+	expected := []Diagnostic{
+		{File: "board.brpc", Line: 2, Column: 20, EndLine: 2, EndColumn: 28, Message: "field: \"Cell\" is undefined", Source: "\trequired cells @1 [64]Cell;"},
+		{File: "game.brpc", Line: 5, Column: 19, EndLine: 5, EndColumn: 23, Message: "field: \"Move\" is undefined", Source: "\trequired move @2 Move;"},
+	}
+	assert.Equal(t, expected, diags)
+	assert.Empty(t, result.Sources)
+	assert.Equal(t, "game.brpc:5:19: field: \"Move\" is undefined", diags[1].String())
+}
+
+func TestCompile_Package(t *testing.T) {
+	files := map[string][]byte{"game.brpc": []byte("message Game struct {}\n")}
+
+	// an invalid package name is reported rather than generating code that does not compile
+	for _, pack := range []string{"", "type", "my-gen"} {
+		result, diags := Compile(files, Options{Package: pack})
+		assert.Empty(t, result.Sources)
+		assert.Equal(t, []Diagnostic{
+			{File: "game.brpc", Line: 1, Column: 1, EndLine: 1, EndColumn: 1, Message: "property: \"" + pack + "\" is not a valid go package name, set the package property to name the generated package", Source: "message Game struct {}"},
+		}, diags)
+	}
+
+	// the package property takes the place of the option
+	files["game.brpc"] = []byte("package = \"game\"\n")
+	result, diags := Compile(files, Options{})
+	assert.Empty(t, diags)
+	assert.Contains(t, string(result.Sources["game.brpc"]), "package game\n")
+}
+
+// goTest writes the generated sources to a package inside the module, so they can import brpc/lib, then vets and tests it with the go tool
+func goTest(t *testing.T, sources map[string][]byte, test string) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is not installed")
+	}
+	// go ./... patterns skip directories starting with an underscore, so the package is only built here
+	dir, err := os.MkdirTemp(".", "_gen")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for path, src := range sources {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(path)+".go"), src, 0644))
+	}
+	if test != "" {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "gen_test.go"), []byte(test), 0644))
+	}
+	for _, cmd := range []string{"vet", "test"} {
+		output, err := exec.Command(goTool, cmd, "./"+dir).CombinedOutput()
+		assert.NoError(t, err, string(output))
+	}
+}
+
+func TestCompile_SharedInstances(t *testing.T) {
+	files := map[string][]byte{
+		"pair.brpc": []byte("message Pair struct(A, B) {\n\trequired first @1 A;\n\trequired second @2 B;\n}\n\nmessage Move struct {\n\trequired at @1 Pair(b8, b8);\n}\n"),
+		"game.brpc": []byte("import \"pair\"\n\nmessage Game struct {\n\trequired last @1 Pair(b8, b8);\n\trequired move @2 Move;\n}\n"),
+	}
+
+	result, diags := Compile(files, Options{Package: "game"})
+	assert.Empty(t, diags)
+
+	// an instantiation used by schemas generated into the same package is declared by the first of them
+	assert.Contains(t, string(result.Sources["game.brpc"]), "type Pair_uint8_uint8 struct")
+	assert.NotContains(t, string(result.Sources["pair.brpc"]), "type Pair_uint8_uint8 struct")
+	goTest(t, result.Sources, "")
+}
+
+func TestCompile_RoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"game.brpc": []byte(`message Color enum {
+	@1 Red;
+	@2 Blue;
+}
+
+message Pair struct(A) {
+	required first @1 A;
+	required second @2 A;
+}
+
+message Game struct {
+	required id @1 int64;
+	required color @2 Color;
+	optional name @3 string;
+	required cells @4 [4]int2;
+	required moves @5 []Pair(b8);
+}
+
+service Games {
+	rpc @1 Get(int64) returns (Game)
+}
+`),
+	}
+
+	result, diags := Compile(files, Options{Package: "game"})
+	assert.Empty(t, diags)
+
+	// the generated code is round tripped through lib, both directly and by a server
+	goTest(t, result.Sources, `package game
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"brpc/lib"
+)
+
+type games struct{}
+
+func (games) Get(ctx context.Context, req *Games_GetRequest) (*Game, error) {
+	if req.Arg1 < 0 {
+		return nil, nil
+	}
+	name := "chess"
+	return NewGame(req.Arg1, ColorBlue, &name, [4]int8{-2, -1, 0, 1}, []Pair_uint8{{First: 1, Second: 2}}), nil
+}
+
+func TestGame(t *testing.T) {
+	name := "chess"
+	game := NewGame(7, ColorRed, &name, [4]int8{-2, -1, 0, 1}, []Pair_uint8{{First: 1, Second: 2}})
+	var buf bytes.Buffer
+	w := lib.NewBitWriter(&buf)
+	if err := game.MarshalBits(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var got Game
+	if err := got.UnmarshalBits(lib.NewBitReader(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 7 || got.Color != ColorRed || *got.Name != name || got.Cells != game.Cells || len(got.Moves) != 1 || got.Moves[0] != game.Moves[0] {
+		t.Fatalf("got %+v, expected %+v", got, *game)
+	}
+
+	// an unset enum is not a case of the enum
+	var ordErr *lib.OrdErr
+	if err := new(Game).MarshalBits(lib.NewBitWriter(&buf)); !errors.As(err, &ordErr) {
+		t.Fatalf("expected an OrdErr, got %v", err)
+	}
+}
+
+func TestGames(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := lib.NewServer()
+	server.Register(GamesId, &GamesDispatcher{Impl: games{}})
+	go server.Serve(l)
+	defer server.Close()
+
+	client, err := lib.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	games := &GamesClient{Invoker: client}
+
+	game, err := games.Get(context.Background(), NewGames_GetRequest(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Id != 7 || game.Color != ColorBlue || *game.Name != "chess" || game.Moves[0].Second != 2 {
+		t.Fatalf("got %+v", *game)
+	}
+
+	var remoteErr *lib.RemoteErr
+	if _, err := games.Get(context.Background(), NewGames_GetRequest(-1)); !errors.As(err, &remoteErr) {
+		t.Fatalf("expected a RemoteErr, got %v", err)
+	}
+}
+`)
+}
+
+func TestCompile_ReadFile(t *testing.T) {
+	files := map[string][]byte{
+		"game.brpc": []byte(`import "lib/board"
+message Game struct {
+	required board @1 Board;
+}
+`),
+	}
+	readFile := func(path string) ([]byte, error) {
+		if path != "lib/board.brpc" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("message Board struct {}"), nil
+	}
+
+	result, diags := Compile(files, Options{Package: "game", ReadFile: readFile})
+
+	assert.Empty(t, diags)
+	assert.Contains(t, string(result.Sources["game.brpc"]), "Board Board\n")
+
+	_, diags = Compile(files, Options{Package: "game"})
+	expected := []Diagnostic{
+		{File: "game.brpc", Line: 1, Column: 1, EndLine: 1, EndColumn: 19, Message: "import: \"lib/board\" could not be found", Source: "import \"lib/board\""},
+		{File: "game.brpc", Line: 3, Column: 20, EndLine: 3, EndColumn: 25, Message: "field: \"Board\" is undefined", Source: "\trequired board @1 Board;"},
+	}
+	assert.Equal(t, expected, diags)
+}
+
+func TestDiagnostic_Snippet(t *testing.T) {
+	diag := Diagnostic{Line: 2, Column: 11, EndLine: 2, EndColumn: 15, Source: "\trequired move @2 Move;"}
+	assert.Equal(t, "\trequired move @2 Move;\n\t         ^^^^", diag.Snippet())
+
+	// a range continuing onto later lines is underlined to the end of its first line
+	diag = Diagnostic{Line: 1, Column: 1, EndLine: 3, EndColumn: 2, Source: "message A struct {"}
+	assert.Equal(t, "message A struct {\n^^^^^^^^^^^^^^^^^^", diag.Snippet())
+
+	// an empty range is still marked
+	diag = Diagnostic{Line: 4, Column: 1, EndLine: 4, EndColumn: 1, Source: ""}
+	assert.Equal(t, "\n^", diag.Snippet())
+}
+
+func TestCompile_Warnings(t *testing.T) {
+	files := map[string][]byte{
+		"color.brpc": []byte("message Color [32]enum {\n\t@1 Red;\n}\n"),
+	}
+
+	result, diags := Compile(files, Options{Package: "game"})
+
+	expected := []Diagnostic{
+		{
+			File:      "color.brpc",
+			Line:      1,
+			Column:    19,
+			EndLine:   3,
+			EndColumn: 2,
+			Message:   "warning: enum: \"Color\" has a width of 32 bits, but its order tags fit in 1 bits",
+			Source:    "message Color [32]enum {",
+			Warning:   true,
+		},
+	}
+	assert.Equal(t, expected, diags)
+	assert.Contains(t, string(result.Sources["color.brpc"]), "type Color int\n")
+}
+
+func TestCheckCompat(t *testing.T) {
+	oldFiles := map[string][]byte{
+		"game.brpc": []byte("message Game struct {\n\trequired id @1 int64;\n\trequired turn @2 bool;\n}\n"),
+	}
+	newFiles := map[string][]byte{
+		"game.brpc": []byte("message Game struct {\n\trequired id @1 int32;\n}\n"),
+	}
+
+	changes, diags := CheckCompat(oldFiles, newFiles, Options{})
+
+	assert.Empty(t, diags)
+	expected := []Diagnostic{
+		{File: "game.brpc", Line: 2, Column: 2, EndLine: 2, EndColumn: 23, Message: "\"Game.id\" changed type from int64 to int32", Source: "\trequired id @1 int32;"},
+		{File: "game.brpc", Line: 3, Column: 2, EndLine: 3, EndColumn: 24, Message: "\"Game.turn\" was removed", Source: "\trequired turn @2 bool;"},
+	}
+	assert.Equal(t, expected, changes)
+
+	// a field the new version uses again after the old version deprecated it is only warned about
+	oldFiles["game.brpc"] = []byte("message Game struct {\n\trequired id @1 int64;\n\tdeprecated turn @2 bool;\n}\n")
+	newFiles["game.brpc"] = []byte("message Game struct {\n\trequired id @1 int64;\n\trequired turn @2 bool;\n}\n")
+	changes, diags = CheckCompat(oldFiles, newFiles, Options{})
+	assert.Empty(t, changes)
+	assert.Equal(t, []Diagnostic{
+		{
+			File:      "game.brpc",
+			Line:      3,
+			Column:    2,
+			EndLine:   3,
+			EndColumn: 24,
+			Message:   "warning: \"Game.turn\" is deprecated in the old schema, but the new schema uses it again",
+			Source:    "\trequired turn @2 bool;",
+			Warning:   true,
+		},
+	}, diags)
+
+	// changes are not reported when a version fails to compile
+	newFiles["game.brpc"] = []byte("message Game struct {\n\trequired id @1 Id;\n}\n")
+	changes, diags = CheckCompat(oldFiles, newFiles, Options{})
+	assert.Empty(t, changes)
+	assert.Len(t, diags, 1)
+}
+
+func TestFormat(t *testing.T) {
+	output, diags := Format("game.brpc", []byte("message Game struct{\nrequired id @1 int64;}"))
+	assert.Empty(t, diags)
+	assert.Equal(t, "message Game struct {\n\trequired id @1 int64;\n}\n", string(output))
+
+	output, diags = Format("game.brpc", []byte("message Game struct {\n\trequired id @1;\n}\n"))
+	assert.Nil(t, output)
+	expected := []Diagnostic{
+		{File: "game.brpc", Line: 2, Column: 16, EndLine: 2, EndColumn: 17, Message: "expected typeref, found ';' while parsing field", Source: "\trequired id @1;"},
+	}
+	assert.Equal(t, expected, diags)
+}
@@ -0,0 +1,25 @@
+package compiler
+
+import (
+	"path/filepath"
+
+	"brpc/internal"
+)
+
+// Format rewrites the schema at path in the canonical layout, keeping its comments
+// nil is returned along with diagnostics if the schema does not parse
+func Format(path string, src []byte) ([]byte, []Diagnostic) {
+	path = filepath.Clean(path)
+
+	var errs []error
+	output := internal.Format(string(src), &errs)
+
+	var diags []Diagnostic
+	for _, err := range errs {
+		diags = append(diags, locate(internal.MakeDiagnostic(err, path), map[string][]byte{path: src}))
+	}
+	if len(diags) > 0 {
+		return nil, diags
+	}
+	return []byte(output), nil
+}
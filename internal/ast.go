@@ -18,6 +18,7 @@ const (
 	ServiceNodeKind
 	RpcNodeKind
 	TypeNodeKind
+	ConstNodeKind
 )
 
 func (kind NodeKind) String() string {
@@ -48,6 +49,8 @@ func (kind NodeKind) String() string {
 		return "rpc"
 	case TypeNodeKind:
 		return "type"
+	case ConstNodeKind:
+		return "const"
 	default:
 		panic(fmt.Sprintf("assertion error: unknown NodeKind: %d", kind))
 	}
@@ -74,22 +77,30 @@ func (m Modifier) String() string {
 	return modStr
 }
 
+// Positions is a range of byte offsets in a file, along with the line and column the range begins at
 type Positions struct {
-	B int
-	E int
+	B    int
+	E    int
+	Line int // starts at 1
+	Col  int // counts bytes, starting at 1
 }
 
-func (r *Positions) Offset() string {
-	if r.B == r.E {
-		return fmt.Sprintf("%d:", r.B)
-	} else {
-		return fmt.Sprintf("%d:%d:", r.B, r.E)
-	}
+// Begin moves the start of the range to the start of p
+func (r *Positions) Begin(p Positions) {
+	r.B = p.B
+	r.Line = p.Line
+	r.Col = p.Col
+}
+
+func (r *Positions) Location() string {
+	return fmt.Sprintf("%d:%d:", r.Line, r.Col)
 }
 
 func (r *Positions) Clear() {
 	r.E = 0
 	r.B = 0
+	r.Line = 0
+	r.Col = 0
 }
 
 type DefNode struct {
@@ -103,6 +114,9 @@ type DefNode struct {
 	TypeParams []string
 	LocalDefs  []DefNode
 	Size       uint64
+	SizeConst  string   // the constant an enum or union declares its width with, which the transformer resolves into Size
+	Literal    *Literal // the value of a constant, or the constant a property is set to
+	Doc        string   // the comment directly above the definition, without its markers
 }
 
 func (n *DefNode) MemberKind() NodeKind {
@@ -128,6 +142,23 @@ type MembNode struct {
 	LType    TypeNode
 	RType    TypeNode
 	TypeIden string
+	Doc      string     // the comment directly above the member and any comment after it on the same line, without their markers
+	Props    []DefNode  // the options written after the type of a field or union option, such as [maxLen = 64]
+	LenWidth uint64     // the width of the length prefix of each variable length dimension, decided by the transformer
+	MaxLen   uint64     // the maximum length of each variable length dimension, 0 if the member sets no limit
+	Params   []MembNode // the parameters of an rpc when they are not a single message type, lowered to a request message by the transformer
+	Results  []MembNode // the results of an rpc when they are not a single message type, lowered to a response message by the transformer
+	LStream  bool       // the client sends a stream of requests rather than a single one
+	RStream  bool       // the server sends a stream of responses rather than a single one
+	Default  *Literal   // the value of a field when it is not set by the constructor or is absent when decoding, nil if there is none
+}
+
+// Literal is a value written in a schema, an iden spells a bool, the case of an enum or a declared constant
+type Literal struct {
+	Positions
+	Kind  TokKind  // TokInteger, TokFloat, TokString or TokIden
+	Value string   // numbers keep their sign, strings have their escape sequences resolved and no quotes
+	Ref   *DefNode // the constant an iden refers to, resolved by the transformer
 }
 
 type TypeNode struct {
@@ -136,4 +167,7 @@ type TypeNode struct {
 	Iden     string
 	TypeArgs []TypeNode
 	Array    []uint64
+	Consts   []string // the constant each fixed dimension is declared with, "" for a dimension written as a number, nil if there are none
+	Ref      *DefNode // the definition the type refers to, resolved by the transformer
+	Param    bool     // the type refers to a type parameter of an enclosing definition
 }
@@ -1,185 +1,1196 @@
 package internal
 
 import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"hash/fnv"
+	"os"
+	"path"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
 )
 
+const LibImport = "brpc/lib"
+
 type CodeBuilder struct {
 	sb          strings.Builder
 	propTable   PropTable
 	importTable ImportTable
+	props       PropTable              // the properties of the file the definition being built is in
+	fileProps   map[*DefNode]PropTable // the properties of the file each imported definition is in
+	packages    map[*DefNode]string    // the go import path of each imported definition generated into another package
+	imports     map[string]bool
+	qualifiers  map[string]bool // the names imported definitions are qualified by, which may differ from the last element of their import path
+	names       map[*DefNode]string
+	outer       map[*DefNode][]string
+	instances   map[string]bool
+	built       map[string]bool // the instantiations generated into the package by schemas compiled before this one, shared with the importer
+	pack        string          // the go package of the file, which keys the instantiations in built
+	added       []string        // the instantiations this file generates, added to built once it has compiled
+	pending     []instance
+	depth       int
+	vars        int
+	loops       int // the number of array loops enclosing the statements being built, so each index is distinct
 	errs        *[]error
 }
 
-func makeCodeBuilder(propTable PropTable, importTable ImportTable, errs *[]error) CodeBuilder {
-	return CodeBuilder{propTable: propTable, importTable: importTable, errs: errs}
+// instance is a generic definition with concrete types substituted for each of its type parameters
+type instance struct {
+	node  *DefNode
+	name  string
+	env   map[string]TypeNode
+	depth int
+}
+
+// maxInstanceDepth bounds instantiations made while building other instantiations
+// a definition that instantiates itself with a larger type would otherwise never finish
+const maxInstanceDepth = 32
+
+func makeCodeBuilder(propTable PropTable, imp *Importer, pack string, errs *[]error) CodeBuilder {
+	b := CodeBuilder{
+		propTable:   propTable,
+		importTable: imp.table,
+		props:       propTable,
+		fileProps:   make(map[*DefNode]PropTable),
+		packages:    make(map[*DefNode]string),
+		imports:     make(map[string]bool),
+		qualifiers:  make(map[string]bool),
+		names:       make(map[*DefNode]string),
+		outer:       make(map[*DefNode][]string),
+		instances:   make(map[string]bool),
+		built:       imp.built,
+		pack:        propTable[GoImportProp] + " " + pack,
+		errs:        errs,
+	}
+	for _, nodes := range imp.table {
+		// imported definitions are named as in their own file, so local definitions built here match theirs
+		b.nameNodes(nodes, "", nil)
+		props := makePropTable(nodes)
+		b.recordProps(nodes, props)
+		goImport := props[GoImportProp]
+		if goImport == "" || goImport == propTable[GoImportProp] {
+			continue
+		}
+		for i := range nodes {
+			b.packages[&nodes[i]] = goImport
+		}
+	}
+	return b
+}
+
+// recordProps records the properties of the file each definition is in, as an imported definition is encoded the way its own file says
+func (b *CodeBuilder) recordProps(nodes []DefNode, props PropTable) {
+	for i := range nodes {
+		b.fileProps[&nodes[i]] = props
+		b.recordProps(nodes[i].LocalDefs, props)
+	}
+}
+
+// nameNodes assigns each definition a go type name, local definitions are qualified by their parent's name
+// the type parameters of the enclosing definitions are recorded too, as local definitions are instantiated along with their parent
+func (b *CodeBuilder) nameNodes(nodes []DefNode, prefix string, params []string) {
+	for i := range nodes {
+		node := &nodes[i]
+		name := prefix + node.Iden
+		b.names[node] = name
+		b.outer[node] = params
+		b.nameNodes(node.LocalDefs, name+"_", append(slices.Clone(params), node.TypeParams...))
+	}
+}
+
+// typeParams returns every type parameter in scope of a definition, starting with those of its enclosing definitions
+func (b *CodeBuilder) typeParams(node *DefNode) []string {
+	return append(slices.Clone(b.outer[node]), node.TypeParams...)
 }
 
 func (b *CodeBuilder) buildNodes(nodes []DefNode) {
-	for _, node := range nodes {
-		b.build(node)
+	for i := range nodes {
+		b.build(&nodes[i])
+	}
+}
+
+func (b *CodeBuilder) build(node *DefNode) {
+	if len(b.typeParams(node)) > 0 {
+		// generic definitions are only built for each instantiation, along with their local definitions
+		return
 	}
+	b.buildDef(node, b.names[node], nil)
+	b.buildNodes(node.LocalDefs)
 }
 
-func (b *CodeBuilder) build(node DefNode) {
+func (b *CodeBuilder) buildDef(node *DefNode, name string, env map[string]TypeNode) {
+	b.props = b.propTable
+	if props, ok := b.fileProps[node]; ok {
+		b.props = props
+	}
+
 	switch node.Kind {
 	case StructNodeKind:
-		b.buildStruct(node)
+		b.buildStruct(node, name, env)
 	case UnionNodeKind:
-		b.buildUnion(node)
+		b.buildUnion(node, name, env)
 	case EnumNodeKind:
-		b.buildEnum(node)
+		b.buildEnum(node, name)
 	case ServiceNodeKind:
-		b.buildService(node)
+		b.buildService(node, name)
+	case ConstNodeKind:
+		b.buildConst(node, name)
 	}
 }
 
+// buildInstances builds each instantiation found while building, which may find further instantiations
+func (b *CodeBuilder) buildInstances() {
+	for len(b.pending) > 0 {
+		inst := b.pending[0]
+		b.pending = b.pending[1:]
+		b.depth = inst.depth
+		b.buildDef(inst.node, inst.name, inst.env)
+	}
+}
+
+// instantiate queues a generic definition to be built with the concrete type arguments, unless it already has been
+// in this file or in another schema generated into the same package
+func (b *CodeBuilder) instantiate(node *DefNode, name string, args []TypeNode) {
+	if b.instances[name] {
+		return
+	}
+	b.instances[name] = true
+	key := b.pack + " " + name
+	if b.built[key] {
+		return
+	}
+	b.added = append(b.added, key)
+	if b.depth == maxInstanceDepth {
+		*b.errs = append(*b.errs, makeInstanceErr(node.Kind, node.Positions, node.Iden))
+		return
+	}
+
+	env := make(map[string]TypeNode)
+	for i, param := range b.typeParams(node) {
+		env[param] = args[i]
+	}
+	b.pending = append(b.pending, instance{node: node, name: name, env: env, depth: b.depth + 1})
+}
+
+// concrete substitutes the type arguments of an instantiation for the type parameters in t
+// references to a local definition of a generic definition are passed the type arguments of the enclosing definitions first
+func (b *CodeBuilder) concrete(t TypeNode, env map[string]TypeNode) TypeNode {
+	if t.Param {
+		arg, ok := env[t.Iden]
+		if !ok {
+			panic(fmt.Sprintf("assertion error: type parameter should be in scope of the instantiation: %s", t.Iden))
+		}
+		arg.Array = append(slices.Clone(t.Array), arg.Array...)
+		return arg
+	}
+	if t.Value.Map {
+		t.TypeArgs = []TypeNode{b.concrete(t.TypeArgs[0], env), b.concrete(t.TypeArgs[1], env)}
+		return t
+	}
+	if t.Ref == nil {
+		return t
+	}
+
+	var args []TypeNode
+	for _, param := range b.outer[t.Ref] {
+		args = append(args, b.concrete(TypeNode{Iden: param, Param: true}, env))
+	}
+	for _, arg := range t.TypeArgs {
+		args = append(args, b.concrete(arg, env))
+	}
+	t.TypeArgs = args
+	return t
+}
+
+// mangle spells a concrete type as part of a go identifier, the spelling is lowercase unless it names a definition
+func (b *CodeBuilder) mangle(t TypeNode) string {
+	var sb strings.Builder
+	for _, size := range t.Array {
+		if size > 0 {
+			fmt.Fprintf(&sb, "array%d_", size)
+		} else {
+			sb.WriteString("slice_")
+		}
+	}
+	if t.Value.Primitive {
+		sb.WriteString(t.Value.Name())
+	} else if t.Value.Map {
+		fmt.Fprintf(&sb, "map_%s_%s", b.mangle(t.TypeArgs[0]), b.mangle(t.TypeArgs[1]))
+	} else {
+		t.Array = nil
+		sb.WriteString(strings.ReplaceAll(b.typeName(t), ".", "_"))
+	}
+	return sb.String()
+}
+
 // this operation is common enough to extract it out to a utility function
 func (b *CodeBuilder) write(s string) {
 	b.sb.WriteString(s)
 }
 
+func (b *CodeBuilder) writef(format string, args ...any) {
+	fmt.Fprintf(&b.sb, format, args...)
+}
+
+// writeDoc writes documentation from the schema as a go comment
+func (b *CodeBuilder) writeDoc(doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			b.write("//\n")
+		} else {
+			b.writef("// %s\n", line)
+		}
+	}
+}
+
 func (b *CodeBuilder) writeIden(s string) {
+	b.write(goIden(s))
+}
+
+func goIden(s string) string {
+	var sb strings.Builder
 	for i, c := range s {
 		if i == 0 {
 			c = unicode.ToUpper(c)
 		}
-		b.sb.WriteRune(c)
+		sb.WriteRune(c)
 	}
+	return sb.String()
 }
 
-func (b *CodeBuilder) buildType(t TypeNode) {
-	for _, size := range t.Array {
-		b.write("[")
+// localIden lowers the first letter of an identifier, so it is unexported or usable as a parameter, avoiding go keywords
+func localIden(s string) string {
+	var sb strings.Builder
+	for i, c := range s {
+		if i == 0 {
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	if token.IsKeyword(sb.String()) {
+		sb.WriteString("_")
+	}
+	return sb.String()
+}
+
+// fieldIden returns the go name of a struct field, deprecated fields are unexported so they are only used through their deprecated accessors
+func fieldIden(field MembNode) string {
+	if field.Modifier == Deprecated {
+		return localIden(field.Iden)
+	}
+	return goIden(field.Iden)
+}
+
+// typeName returns the go name of a concrete type, instantiating the definition it refers to if it has type arguments
+func (b *CodeBuilder) typeName(t TypeNode) string {
+	if t.Value.Primitive {
+		native := t.Value.Native()
+		if native == "big.Int" {
+			b.imports["math/big"] = true
+		}
+		return native
+	}
+	if t.Value.Map {
+		key, value := t.TypeArgs[0], t.TypeArgs[1]
+		return "map[" + b.typeString(key, key.Array) + "]" + b.typeString(value, value.Array)
+	}
+	if t.Ref == nil {
+		panic(fmt.Sprintf("assertion error: type should have been resolved by the transformer: %s", t.Iden))
+	}
+	name, ok := b.names[t.Ref]
+	if !ok {
+		panic(fmt.Sprintf("assertion error: definition should have been named: %s", t.Iden))
+	}
+	if len(t.TypeArgs) == 0 {
+		return b.qualify(t.Ref, name)
+	}
+	for _, arg := range t.TypeArgs {
+		name += "_" + b.mangle(arg)
+	}
+	b.instantiate(t.Ref, name, t.TypeArgs)
+	return name
+}
+
+// qualify prefixes the name of a definition imported from a schema generated into another go package with that package
+// generic definitions are never qualified, as each instantiation is built in the first file of the package using it
+func (b *CodeBuilder) qualify(node *DefNode, name string) string {
+	goImport, ok := b.packages[node]
+	if !ok {
+		return name
+	}
+	b.imports[goImport] = true
+	pack := b.fileProps[node][PackageProp]
+	if pack == "" {
+		pack = path.Base(goImport)
+	}
+	b.qualifiers[pack] = true
+	return pack + "." + name
+}
+
+// order is the suffix of the lib methods that write values in the byte order of the definition being built
+func (b *CodeBuilder) order() string {
+	if b.props[ByteOrderProp] == "little" {
+		return "LE"
+	}
+	return ""
+}
+
+func (b *CodeBuilder) typeString(t TypeNode, dims []uint64) string {
+	var sb strings.Builder
+	for _, size := range dims {
+		sb.WriteString("[")
 		if size > 0 {
-			b.write(strconv.FormatUint(size, 10))
+			sb.WriteString(strconv.FormatUint(size, 10))
+		}
+		sb.WriteString("]")
+	}
+	sb.WriteString(b.typeName(t))
+	return sb.String()
+}
+
+func (b *CodeBuilder) buildType(t TypeNode) {
+	b.write(b.typeString(t, t.Array))
+}
+
+// nextVar returns a fresh local variable name for the method being built
+func (b *CodeBuilder) nextVar() string {
+	v := fmt.Sprintf("v%d", b.vars)
+	b.vars++
+	return v
+}
+
+func (b *CodeBuilder) writeCheck(call string) {
+	b.writef("if err := %s; err != nil {\nreturn err\n}\n", call)
+}
+
+// writeFieldCheck annotates the error with the field it was returned while encoding
+func (b *CodeBuilder) writeFieldCheck(field string, call string) {
+	b.writef("if err := %s; err != nil {\nreturn lib.InField(err, %s)\n}\n", call, strconv.Quote(field))
+}
+
+func (b *CodeBuilder) writeRead(v string, call string) {
+	b.writef("%s, err := %s\nif err != nil {\nreturn err\n}\n", v, call)
+}
+
+// derefExpr dereferences a pointer to a value of type t, messages are left as pointers since their methods have pointer receivers
+func derefExpr(expr string, t TypeNode) string {
+	if len(t.Array) > 0 || t.Value.Primitive || t.Value.Map {
+		return "*" + expr
+	}
+	return expr
+}
+
+// fieldExpr returns the expression used to access the value of a field, dereferencing optional fields
+func fieldExpr(field MembNode, t TypeNode) string {
+	expr := "m." + fieldIden(field)
+	if field.Modifier != Optional {
+		return expr
+	}
+	return derefExpr(expr, t)
+}
+
+// indexExpr indexes into an array expression, parenthesizing dereferences
+func indexExpr(expr string, idx string) string {
+	if strings.HasPrefix(expr, "*") {
+		expr = "(" + expr + ")"
+	}
+	return fmt.Sprintf("%s[%s]", expr, idx)
+}
+
+// lenWidth returns the width of the length prefixes of a member, which the transformer decides for every field and union option
+func lenWidth(member MembNode) uint64 {
+	if member.LenWidth == 0 {
+		panic(fmt.Sprintf("assertion error: length prefix width of \"%s\" was not decided", member.Iden))
+	}
+	return member.LenWidth
+}
+
+// buildEncode writes the statements to encode expr, a value of type t with the remaining array dimensions dims
+// errors are annotated with the field being encoded, so a value out of range can be traced through nested messages
+// the output is not indented, the generated file is formatted once it is complete
+func (b *CodeBuilder) buildEncode(member MembNode, expr string, t TypeNode, dims []uint64) {
+	field := member.Iden
+	if len(dims) > 0 {
+		idx := fmt.Sprintf("i%d", b.loops)
+		if dims[0] == 0 {
+			// variable length dimensions are prefixed with their length, fixed dimensions are known by the reader
+			b.buildEncodeLen(member, expr)
+		}
+		b.writef("for %s := range %s {\n", idx, expr)
+		b.loops++
+		b.buildEncode(member, indexExpr(expr, idx), t, dims[1:])
+		b.loops--
+		b.write("}\n")
+		return
+	}
+
+	typ := t.Value
+	order := b.order()
+	switch {
+	case typ.Map:
+		// maps are prefixed with their number of entries, which are written in ascending order of their keys so equal maps are encoded the same
+		key, value := t.TypeArgs[0], t.TypeArgs[1]
+		sorted := "lib.SortedKeys"
+		if key.Value.Iden == "bool" {
+			sorted = "lib.SortedBoolKeys"
+		}
+		b.buildEncodeLen(member, expr)
+		k, e := b.nextVar(), b.nextVar()
+		b.writef("for _, %s := range %s(%s) {\n", k, sorted, expr)
+		b.writef("%s := %s\n", e, indexExpr(expr, k))
+		b.buildEncode(member, k, key, key.Array)
+		b.buildEncode(member, e, value, value.Array)
+		b.write("}\n")
+	case !typ.Primitive:
+		b.writeFieldCheck(field, fmt.Sprintf("%s.MarshalBits(w)", expr))
+	case typ.Bits > 64 && typ.Signed:
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteBigInt%s(%s, %d)", order, expr, typ.Bits))
+	case typ.Bits > 64:
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteBigUint%s(%s, %d)", order, expr, typ.Bits))
+	case typ.Bits > 0 && typ.Signed:
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteInt64%s(int64(%s), %d)", order, expr, typ.Bits))
+	case typ.Bits > 0:
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteUint64%s(uint64(%s), %d)", order, expr, typ.Bits))
+	case typ.Iden == "bool":
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteBool(%s)", expr))
+	case typ.Iden == "float32":
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteFloat32%s(%s)", order, expr))
+	case typ.Iden == "float64":
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteFloat64%s(%s)", order, expr))
+	case typ.Iden == "string":
+		if b.props[StringEncodingProp] == "utf8" {
+			b.writeFieldCheck(field, fmt.Sprintf("lib.CheckUTF8(%s)", expr))
+		}
+		b.writeFieldCheck(field, fmt.Sprintf("w.WriteString%s(%s)", order, expr))
+	default:
+		panic(fmt.Sprintf("assertion error: unknown primitive type: %+v", typ))
+	}
+}
+
+// buildEncodeLen writes the length prefix of a variable length array or a map, checking it against the limit of the member if it has one
+func (b *CodeBuilder) buildEncodeLen(member MembNode, expr string) {
+	if member.MaxLen > 0 {
+		b.writeFieldCheck(member.Iden, fmt.Sprintf("lib.CheckLen(uint64(len(%s)), %d)", expr, member.MaxLen))
+	}
+	b.writeFieldCheck(member.Iden, fmt.Sprintf("w.WriteUint64%s(uint64(len(%s)), %d)", b.order(), expr, lenWidth(member)))
+}
+
+// buildDecodeLen reads the length prefix of a variable length array or a map, checking it against the limit of the member
+func (b *CodeBuilder) buildDecodeLen(member MembNode) string {
+	maxLen := "lib.MaxLen"
+	if member.MaxLen > 0 {
+		maxLen = strconv.FormatUint(member.MaxLen, 10)
+	}
+	v := b.nextVar()
+	b.writeRead(v, fmt.Sprintf("r.ReadUint64%s(%d)", b.order(), lenWidth(member)))
+	b.writeCheck(fmt.Sprintf("lib.CheckLen(%s, %s)", v, maxLen))
+	return v
+}
+
+// buildDecode writes the statements to decode into expr, the counterpart to buildEncode
+// slices and maps grow as their elements are decoded, so a hostile length prefix cannot allocate more than the data sent with it
+func (b *CodeBuilder) buildDecode(member MembNode, expr string, t TypeNode, dims []uint64) {
+	if len(dims) > 0 && dims[0] == 0 {
+		v := b.buildDecodeLen(member)
+		e := b.nextVar()
+		b.writef("%s = make(%s, 0)\n", expr, b.typeString(t, dims))
+		b.writef("for range %s {\n", v)
+		b.writef("var %s %s\n", e, b.typeString(t, dims[1:]))
+		b.buildDecode(member, e, t, dims[1:])
+		b.writef("%s = append(%s, %s)\n", expr, expr, e)
+		b.write("}\n")
+		return
+	}
+	if len(dims) > 0 {
+		idx := fmt.Sprintf("i%d", b.loops)
+		b.writef("for %s := range %s {\n", idx, expr)
+		b.loops++
+		b.buildDecode(member, indexExpr(expr, idx), t, dims[1:])
+		b.loops--
+		b.write("}\n")
+		return
+	}
+
+	typ := t.Value
+	if typ.Map {
+		key, value := t.TypeArgs[0], t.TypeArgs[1]
+		// keys must be in the strictly ascending order they are encoded in, so no map has a second encoding
+		check := "lib.CheckKeyOrder"
+		if key.Value.Iden == "bool" {
+			check = "lib.CheckBoolKeyOrder"
 		}
-		b.write("]")
+		v := b.buildDecodeLen(member)
+		b.writef("%s = make(%s)\n", expr, b.typeString(t, nil))
+		i, prev, k, e := b.nextVar(), b.nextVar(), b.nextVar(), b.nextVar()
+		b.writef("var %s %s\n", prev, b.typeString(key, key.Array))
+		b.writef("for %s := range %s {\n", i, v)
+		b.writef("var %s %s\n", k, b.typeString(key, key.Array))
+		b.buildDecode(member, k, key, key.Array)
+		b.writef("if %s > 0 {\n", i)
+		b.writeCheck(fmt.Sprintf("%s(%s, %s)", check, prev, k))
+		b.write("}\n")
+		b.writef("%s = %s\n", prev, k)
+		b.writef("var %s %s\n", e, b.typeString(value, value.Array))
+		b.buildDecode(member, e, value, value.Array)
+		b.writef("%s = %s\n", indexExpr(expr, k), e)
+		b.write("}\n")
+		return
+	}
+	if !typ.Primitive {
+		b.writeCheck(fmt.Sprintf("%s.UnmarshalBits(r)", expr))
+		return
 	}
-	b.write(t.Value.Native())
+
+	v := b.nextVar()
+	order := b.order()
+	switch {
+	case typ.Bits > 64 && typ.Signed:
+		b.writeRead(v, fmt.Sprintf("r.ReadBigInt%s(%d)", order, typ.Bits))
+	case typ.Bits > 64:
+		b.writeRead(v, fmt.Sprintf("r.ReadBigUint%s(%d)", order, typ.Bits))
+	case typ.Bits > 0 && typ.Signed:
+		b.writeRead(v, fmt.Sprintf("r.ReadInt64%s(%d)", order, typ.Bits))
+		v = fmt.Sprintf("%s(%s)", typ.Native(), v)
+	case typ.Bits > 0:
+		b.writeRead(v, fmt.Sprintf("r.ReadUint64%s(%d)", order, typ.Bits))
+		v = fmt.Sprintf("%s(%s)", typ.Native(), v)
+	case typ.Iden == "bool":
+		b.writeRead(v, "r.ReadBool()")
+	case typ.Iden == "float32":
+		b.writeRead(v, fmt.Sprintf("r.ReadFloat32%s()", order))
+	case typ.Iden == "float64":
+		b.writeRead(v, fmt.Sprintf("r.ReadFloat64%s()", order))
+	case typ.Iden == "string":
+		b.writeRead(v, fmt.Sprintf("r.ReadString%s()", order))
+		if b.props[StringEncodingProp] == "utf8" {
+			b.writeCheck(fmt.Sprintf("lib.CheckUTF8(%s)", v))
+		}
+	default:
+		panic(fmt.Sprintf("assertion error: unknown primitive type: %+v", typ))
+	}
+	b.writef("%s = %s\n", expr, v)
 }
 
-func (b *CodeBuilder) buildStruct(strct DefNode) {
+func (b *CodeBuilder) buildStruct(strct *DefNode, name string, env map[string]TypeNode) {
 	if strct.Poisoned {
 		return
 	}
+	b.imports[LibImport] = true
+
+	types := make([]TypeNode, len(strct.Members))
+	for i, field := range strct.Members {
+		types[i] = b.concrete(field.LType, env)
+	}
 
 	// build out the struct type definition
+	b.writeDoc(strct.Doc)
 	b.write("type ")
-	b.write(strct.Iden)
+	b.write(name)
 	b.write(" struct {\n")
-	for _, field := range strct.Members {
+	for i, field := range strct.Members {
+		b.writeDoc(field.Doc)
 		b.write("\t")
-		b.writeIden(field.Iden)
+		b.write(fieldIden(field))
 		b.write("\t")
-		b.buildType(field.LType)
+		if field.Modifier == Optional {
+			// optional fields are nil when they are not present
+			b.write("*")
+		}
+		b.buildType(types[i])
 		b.write("\n")
 	}
 	b.write("}\n\n")
+	b.buildConstructor(strct, name, types)
+	b.buildAccessors(strct, name, types)
+
+	// build out the struct's serialize and deserialize methods, fields are sorted by ord during validation
+	b.vars = 0
+	b.writef("func (m *%s) MarshalBits(w *lib.BitWriter) error {\n", name)
+	for i, field := range strct.Members {
+		typ := types[i]
+		expr := fieldExpr(field, typ)
+		if field.Modifier == Optional {
+			// optional fields have a presence bit packed in front of them
+			present := fmt.Sprintf("m.%s != nil", fieldIden(field))
+			b.writeCheck(fmt.Sprintf("w.WriteBool(%s)", present))
+			b.writef("if %s {\n", present)
+			b.buildEncode(field, expr, typ, typ.Array)
+			b.write("}\n")
+		} else {
+			b.buildEncode(field, expr, typ, typ.Array)
+		}
+	}
+	b.write("return nil\n}\n\n")
+
+	b.vars = 0
+	b.writef("func (m *%s) UnmarshalBits(r *lib.BitReader) error {\n", name)
+	for i, field := range strct.Members {
+		typ := types[i]
+		expr := fieldExpr(field, typ)
+		if field.Modifier == Optional {
+			v := b.nextVar()
+			b.writeRead(v, "r.ReadBool()")
+			b.writef("if %s {\n", v)
+			b.writef("m.%s = new(%s)\n", fieldIden(field), b.typeString(typ, typ.Array))
+			b.buildDecode(field, expr, typ, typ.Array)
+			if field.Default != nil {
+				// an absent field takes its default rather than being left unset
+				b.writef("} else {\nm.%s = %s\n", fieldIden(field), b.defaultPtr(*field.Default, typ))
+			}
+			b.write("}\n")
+		} else {
+			b.buildDecode(field, expr, typ, typ.Array)
+		}
+	}
+	b.write("return nil\n}\n\n")
+}
 
-	// build out the struct's serialize and deserialize methods
+// goLiteral spells a literal number or string in go
+func goLiteral(lit Literal) string {
+	if lit.Kind == TokString {
+		return strconv.Quote(lit.Value)
+	}
+	return lit.Value
+}
+
+// defaultExpr returns the go expression of the default of a field of type t, which the transformer checked is a value of t
+func (b *CodeBuilder) defaultExpr(lit Literal, t TypeNode) string {
+	switch {
+	case t.Ref != nil:
+		return b.typeName(t) + lit.Value
+	case t.Value.Native() == "big.Int":
+		// a big integer is built from its digits, even when the default is a constant
+		if lit.Ref != nil {
+			lit = *lit.Ref.Literal
+		}
+		return fmt.Sprintf("lib.BigInt(%s)", strconv.Quote(lit.Value))
+	case lit.Ref != nil:
+		return b.qualify(lit.Ref, lit.Ref.Iden)
+	default:
+		return goLiteral(lit)
+	}
+}
+
+// defaultPtr returns an expression pointing to a new value holding the default of an optional field
+func (b *CodeBuilder) defaultPtr(lit Literal, t TypeNode) string {
+	return fmt.Sprintf("lib.Ptr[%s](%s)", b.typeString(t, t.Array), b.defaultExpr(lit, t))
+}
+
+// buildConstructor builds a function taking each field of a struct other than its deprecated fields, so new code does not set them
+// fields with a default are not taken either, they start with their default and can be changed once the struct is built
+func (b *CodeBuilder) buildConstructor(strct *DefNode, name string, types []TypeNode) {
+	values := make([]string, len(strct.Members))
+	typs := make([]string, len(strct.Members))
+	for i, field := range strct.Members {
+		if field.Default != nil {
+			value := b.defaultExpr(*field.Default, types[i])
+			if field.Modifier == Optional {
+				value = b.defaultPtr(*field.Default, types[i])
+			}
+			values[i] = fieldIden(field) + ": " + value
+		} else if field.Modifier != Deprecated {
+			typs[i] = b.typeString(types[i], types[i].Array)
+			if field.Modifier == Optional {
+				typs[i] = "*" + typs[i]
+			}
+		}
+	}
+
+	// parameters are named once every package the constructor refers to has been imported, so none shadows one
+	var params []string
+	for i, field := range strct.Members {
+		if typs[i] == "" {
+			continue
+		}
+		param := localIden(field.Iden)
+		if b.isPackage(param) {
+			param += "_"
+		}
+		params = append(params, param+" "+typs[i])
+		values[i] = goIden(field.Iden) + ": " + param
+	}
+	values = slices.DeleteFunc(values, func(value string) bool { return value == "" })
+	b.writef("func New%s(%s) *%s {\n", name, strings.Join(params, ", "), name)
+	b.writef("return &%s{%s}\n", name, strings.Join(values, ", "))
+	b.write("}\n\n")
 }
 
-func (b *CodeBuilder) buildUnion(union DefNode) {
+// isPackage reports whether name refers to a package imported by the file being built
+func (b *CodeBuilder) isPackage(name string) bool {
+	for imp := range b.imports {
+		if path.Base(imp) == name {
+			return true
+		}
+	}
+	return b.qualifiers[name]
+}
+
+// buildAccessors builds a getter and setter for each deprecated field of a struct, marked deprecated so go tooling warns where they are used
+func (b *CodeBuilder) buildAccessors(strct *DefNode, name string, types []TypeNode) {
+	for i, field := range strct.Members {
+		if field.Modifier != Deprecated {
+			continue
+		}
+		iden := goIden(field.Iden)
+		typ := b.typeString(types[i], types[i].Array)
+		b.writef("// Deprecated: %s is deprecated in the schema, it is only kept so data written by older peers can still be read.\n", iden)
+		b.writef("func (m *%s) %s() %s {\nreturn m.%s\n}\n\n", name, iden, typ, fieldIden(field))
+		b.writef("// Deprecated: %s is deprecated in the schema, it is only kept so data written by older peers can still be read.\n", iden)
+		b.writef("func (m *%s) Set%s(v %s) {\nm.%s = v\n}\n\n", name, iden, typ, fieldIden(field))
+	}
+}
+
+func (b *CodeBuilder) buildUnion(union *DefNode, name string, env map[string]TypeNode) {
 	if union.Poisoned {
 		return
 	}
+	b.imports[LibImport] = true
 
-	// build out the union type definition
+	types := make([]TypeNode, len(union.Members))
+	for i, option := range union.Members {
+		types[i] = b.concrete(option.LType, env)
+	}
+
+	// build out the union type definition, each kind is the ord of the option, leaving the zero value unset
 	b.write("type ")
-	b.write(union.Iden)
+	b.write(name)
 	b.write("Kind int\n\n")
 	b.write("const (\n")
-	for i, c := range union.Members {
+	for _, c := range union.Members {
 		b.write("\t")
-		b.write(union.Iden)
+		b.write(name)
 		b.write("Kind")
 		b.writeIden(c.Iden)
-		if i == 0 {
-			b.write(" ")
-			b.write(union.Iden)
-			b.write("Kind = iota")
-		}
+		b.write(" ")
+		b.write(name)
+		b.write("Kind = ")
+		b.write(strconv.FormatUint(c.Ord, 10))
 		b.write("\n")
 	}
 	b.write(")\n\n")
 
+	b.writeDoc(union.Doc)
 	b.write("type ")
-	b.write(union.Iden)
+	b.write(name)
 	b.write(" struct {\n")
 	b.write("\tKind\t")
-	b.write(union.Iden)
+	b.write(name)
 	b.write("Kind\n")
-	for _, option := range union.Members {
+	for i, option := range union.Members {
+		b.writeDoc(option.Doc)
 		b.write("\t")
 		b.writeIden(option.Iden)
 		b.write("\t*")
-		b.buildType(option.LType)
+		b.buildType(types[i])
 		b.write("\n")
 	}
 	b.write("}\n\n")
 
-	// build out the union's serialize and deserialize methods
+	// build out the union's serialize and deserialize methods, the ord of the option is packed in front of the payload
+	b.vars = 0
+	b.writef("func (m *%s) MarshalBits(w *lib.BitWriter) error {\n", name)
+	b.write("switch m.Kind {\n")
+	for i, option := range union.Members {
+		b.writef("case %sKind%s:\n", name, goIden(option.Iden))
+
+		// the option for the kind must be the only option that is set
+		var conds []string
+		for _, other := range union.Members {
+			op := "!="
+			if other.Ord == option.Ord {
+				op = "=="
+			}
+			conds = append(conds, fmt.Sprintf("m.%s %s nil", goIden(other.Iden), op))
+		}
+		b.writef("if %s {\n", strings.Join(conds, " || "))
+		b.writef("return &lib.UnionErr{Type: %s, Kind: int(m.Kind)}\n", strconv.Quote(name))
+		b.write("}\n")
+
+		b.writeCheck(fmt.Sprintf("w.WriteUint64%s(uint64(m.Kind), %d)", b.order(), union.Size))
+		b.buildEncode(option, derefExpr("m."+goIden(option.Iden), types[i]), types[i], types[i].Array)
+	}
+	b.write("default:\n")
+	b.writef("return &lib.UnionErr{Type: %s, Kind: int(m.Kind)}\n", strconv.Quote(name))
+	b.write("}\n")
+	b.write("return nil\n}\n\n")
+
+	b.vars = 0
+	b.writef("func (m *%s) UnmarshalBits(r *lib.BitReader) error {\n", name)
+	ord := b.nextVar()
+	b.writeRead(ord, fmt.Sprintf("r.ReadUint64%s(%d)", b.order(), union.Size))
+	b.writef("*m = %s{Kind: %sKind(%s)}\n", name, name, ord)
+	b.write("switch m.Kind {\n")
+	for i, option := range union.Members {
+		iden := goIden(option.Iden)
+		b.writef("case %sKind%s:\n", name, iden)
+		b.writef("m.%s = new(%s)\n", iden, b.typeString(types[i], types[i].Array))
+		b.buildDecode(option, derefExpr("m."+iden, types[i]), types[i], types[i].Array)
+	}
+	b.write("default:\n")
+	b.writef("return &lib.OrdErr{Type: %s, Ord: %s}\n", strconv.Quote(name), ord)
+	b.write("}\n")
+	b.write("return nil\n}\n\n")
 }
 
-func (b *CodeBuilder) buildEnum(enum DefNode) {
+func (b *CodeBuilder) buildEnum(enum *DefNode, name string) {
 	if enum.Poisoned {
 		return
 	}
+	b.imports[LibImport] = true
+	b.imports["strconv"] = true
 
-	// build out the enum type definition and cases
+	// build out the enum type definition and cases, the value of each case is its ord
+	b.writeDoc(enum.Doc)
 	b.write("type ")
-	b.write(enum.Iden)
+	b.write(name)
 	b.write(" int\n\n")
 	b.write("const (\n")
-	for i, c := range enum.Members {
+	for _, c := range enum.Members {
+		b.writeDoc(c.Doc)
 		b.write("\t")
-		b.write(enum.Iden)
+		b.write(name)
 		b.write(c.Iden)
-		if i == 0 {
-			b.write(" ")
-			b.write(enum.Iden)
-			b.write(" = iota")
-		}
+		b.write(" ")
+		b.write(name)
+		b.write(" = ")
+		b.write(strconv.FormatUint(c.Ord, 10))
 		b.write("\n")
 	}
 	b.write(")\n\n")
 
-	// build out the enum's serialize and deserialize methods
+	// build out the enum's name conversions
+	b.writef("func (m %s) String() string {\n", name)
+	b.write("switch m {\n")
+	for _, c := range enum.Members {
+		b.writef("case %s%s:\nreturn %s\n", name, c.Iden, strconv.Quote(c.Iden))
+	}
+	b.write("}\n")
+	b.writef("return %s + strconv.Itoa(int(m)) + \")\"\n", strconv.Quote(name+"("))
+	b.write("}\n\n")
+
+	b.writef("func Parse%s(s string) (%s, error) {\n", name, name)
+	b.write("switch s {\n")
+	for _, c := range enum.Members {
+		b.writef("case %s:\nreturn %s%s, nil\n", strconv.Quote(c.Iden), name, c.Iden)
+	}
+	b.write("}\n")
+	b.writef("return 0, &lib.CaseErr{Type: %s, Name: s}\n", strconv.Quote(name))
+	b.write("}\n\n")
+
+	// build out the enum's serialize and deserialize methods, only ords of known cases are accepted either way
+	var cases []string
+	for _, c := range enum.Members {
+		cases = append(cases, name+c.Iden)
+	}
+	b.writef("func (m %s) MarshalBits(w *lib.BitWriter) error {\n", name)
+	if len(cases) > 0 {
+		b.write("switch m {\n")
+		b.writef("case %s:\n", strings.Join(cases, ", "))
+		b.writef("return w.WriteUint64%s(uint64(m), %d)\n", b.order(), enum.Size)
+		b.write("}\n")
+	}
+	b.writef("return &lib.OrdErr{Type: %s, Ord: uint64(m)}\n", strconv.Quote(name))
+	b.write("}\n\n")
+
+	b.vars = 0
+	b.writef("func (m *%s) UnmarshalBits(r *lib.BitReader) error {\n", name)
+	ord := b.nextVar()
+	b.writeRead(ord, fmt.Sprintf("r.ReadUint64%s(%d)", b.order(), enum.Size))
+	if len(cases) > 0 {
+		b.writef("switch %s(%s) {\n", name, ord)
+		b.writef("case %s:\n", strings.Join(cases, ", "))
+		b.writef("*m = %s(%s)\nreturn nil\n", name, ord)
+		b.write("}\n")
+	}
+	b.writef("return &lib.OrdErr{Type: %s, Ord: %s}\n", strconv.Quote(name), ord)
+	b.write("}\n\n")
+}
+
+// buildConst builds an untyped go constant, so it can be used with any type the schema uses it with
+func (b *CodeBuilder) buildConst(cnst *DefNode, name string) {
+	if cnst.Poisoned {
+		return
+	}
+	b.writeDoc(cnst.Doc)
+	b.writef("const %s = %s\n\n", name, goLiteral(*cnst.Literal))
+}
+
+// serviceId identifies a service on the wire, derived from its name so peers agree on it without coordination
+func serviceId(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()
 }
 
-func (b *CodeBuilder) buildService(svc DefNode) {
+func (b *CodeBuilder) buildService(svc *DefNode, name string) {
 	if svc.Poisoned {
 		return
 	}
+	b.imports[LibImport] = true
+	b.imports["context"] = true
+
+	b.writef("const %sId uint32 = %#x\n\n", name, serviceId(name))
+
+	streams := false
+	for _, rpc := range svc.Members {
+		if isStream(rpc) {
+			streams = true
+			b.buildStreams(rpc, name)
+		}
+	}
+
+	// build out the service interface, implemented by the server
+	b.writeDoc(svc.Doc)
+	b.writef("type %s interface {\n", name)
+	for _, rpc := range svc.Members {
+		b.writeDoc(rpc.Doc)
+		b.writeIden(rpc.Iden)
+		b.write(b.serverSignature(rpc, name))
+		b.write("\n")
+	}
+	b.write("}\n\n")
+
+	// build out the dispatcher, which routes requests to the interface by the ord of the rpc
+	b.writef("type %sDispatcher struct {\n\tImpl %s\n}\n\n", name, name)
+	b.writef("func (d *%sDispatcher) Handle(ctx context.Context, ord uint64, r *lib.BitReader) (lib.Message, error) {\n", name)
+	b.write("switch ord {\n")
+	for _, rpc := range svc.Members {
+		if isStream(rpc) {
+			continue
+		}
+		b.writef("case %d:\n", rpc.Ord)
+		b.writef("req := new(%s)\n", b.typeName(rpc.LType))
+		b.write("if err := req.UnmarshalBits(r); err != nil {\nreturn nil, err\n}\n")
+		b.write("resp, err := d.Impl.")
+		b.writeIden(rpc.Iden)
+		b.write("(ctx, req)\n")
+		b.write("if err != nil {\nreturn nil, err\n}\n")
+		// a nil response would be wrapped in a non-nil message, which cannot be encoded
+		b.write("if resp == nil {\nreturn nil, lib.ErrNilResponse\n}\n")
+		b.write("return resp, nil\n")
+	}
+	b.write("}\n")
+	b.writef("return nil, &lib.OrdErr{Type: %s, Ord: ord}\n", strconv.Quote(name))
+	b.write("}\n\n")
+	if streams {
+		b.buildStreamDispatcher(svc, name)
+	}
+
+	// build out the client, which encodes each request and waits for the typed response
+	b.writef("type %sClient struct {\n\tInvoker lib.Invoker\n}\n\n", name)
+	for _, rpc := range svc.Members {
+		b.writeDoc(rpc.Doc)
+		b.writef("func (c *%sClient) ", name)
+		b.writeIden(rpc.Iden)
+		b.write(b.clientSignature(rpc, name))
+		b.write(" {\n")
+		if isStream(rpc) {
+			b.buildStreamCall(rpc, name)
+			continue
+		}
+		respType := b.typeName(rpc.RType)
+		b.writef("resp := new(%s)\n", respType)
+		b.writef("if err := c.Invoker.Invoke(ctx, %sId, %d, req, resp); err != nil {\nreturn nil, err\n}\n", name, rpc.Ord)
+		b.write("return resp, nil\n")
+		b.write("}\n\n")
+	}
+}
 
+func isStream(rpc MembNode) bool {
+	return rpc.LStream || rpc.RStream
 }
 
-func (b *CodeBuilder) buildPackage(pack string) {
-	b.write("package ")
-	b.write(pack)
-	b.write("\n\n")
+// streamName names the typed stream interface of an rpc on one side of the call, such as Games_WatchServerStream
+func streamName(name string, rpc MembNode, side string) string {
+	return name + "_" + goIden(rpc.Iden) + side + "Stream"
+}
+
+// serverSignature is the signature of an rpc in the service interface, a streamed side of the call is handled through a typed stream
+func (b *CodeBuilder) serverSignature(rpc MembNode, name string) string {
+	reqType := b.typeName(rpc.LType)
+	respType := b.typeName(rpc.RType)
+	stream := streamName(name, rpc, "Server")
+	switch {
+	case rpc.LStream && rpc.RStream:
+		return fmt.Sprintf("(ctx context.Context, stream %s) error", stream)
+	case rpc.LStream:
+		return fmt.Sprintf("(ctx context.Context, stream %s) (*%s, error)", stream, respType)
+	case rpc.RStream:
+		return fmt.Sprintf("(ctx context.Context, req *%s, stream %s) error", reqType, stream)
+	default:
+		return fmt.Sprintf("(ctx context.Context, req *%s) (*%s, error)", reqType, respType)
+	}
+}
+
+// clientSignature is the signature of an rpc in the client, a streaming rpc returns a typed stream once the call is open
+func (b *CodeBuilder) clientSignature(rpc MembNode, name string) string {
+	reqType := b.typeName(rpc.LType)
+	stream := streamName(name, rpc, "Client")
+	switch {
+	case rpc.LStream:
+		return fmt.Sprintf("(ctx context.Context) (%s, error)", stream)
+	case rpc.RStream:
+		return fmt.Sprintf("(ctx context.Context, req *%s) (%s, error)", reqType, stream)
+	default:
+		return fmt.Sprintf("(ctx context.Context, req *%s) (*%s, error)", reqType, b.typeName(rpc.RType))
+	}
+}
+
+// buildStreams declares the typed streams of an rpc for the server and the client, each only has the methods its side may call
+func (b *CodeBuilder) buildStreams(rpc MembNode, name string) {
+	reqType := b.typeName(rpc.LType)
+	respType := b.typeName(rpc.RType)
+
+	b.writef("type %s interface {\n", streamName(name, rpc, "Server"))
+	if rpc.RStream {
+		b.writef("Send(m *%s) error\n", respType)
+	}
+	if rpc.LStream {
+		b.writef("Recv() (*%s, error)\n", reqType)
+	}
+	b.write("}\n\n")
+
+	b.writef("type %s interface {\n", streamName(name, rpc, "Client"))
+	if rpc.LStream {
+		b.writef("Send(m *%s) error\n", reqType)
+		b.write("CloseSend() error\n")
+	}
+	b.writef("Recv() (*%s, error)\n", respType)
+	b.write("}\n\n")
+}
+
+// buildStreamDispatcher routes the streaming rpcs of a service by their ord, reading the single request or sending the single response of a half that does not stream
+func (b *CodeBuilder) buildStreamDispatcher(svc *DefNode, name string) {
+	b.writef("func (d *%sDispatcher) HandleStream(ctx context.Context, ord uint64, s lib.Stream) error {\n", name)
+	b.write("switch ord {\n")
+	for _, rpc := range svc.Members {
+		if !isStream(rpc) {
+			continue
+		}
+		reqType := b.typeName(rpc.LType)
+		respType := b.typeName(rpc.RType)
+		stream := fmt.Sprintf("lib.TypedStream[*%s, %s, *%s]{Stream: s}", respType, reqType, reqType)
+
+		b.writef("case %d:\n", rpc.Ord)
+		switch {
+		case rpc.LStream && rpc.RStream:
+			b.write("return d.Impl.")
+			b.writeIden(rpc.Iden)
+			b.writef("(ctx, %s)\n", stream)
+		case rpc.LStream:
+			b.write("resp, err := d.Impl.")
+			b.writeIden(rpc.Iden)
+			b.writef("(ctx, %s)\n", stream)
+			b.write("if err != nil {\nreturn err\n}\n")
+			b.write("if resp == nil {\nreturn lib.ErrNilResponse\n}\n")
+			b.write("return s.Send(resp)\n")
+		default:
+			b.writef("req := new(%s)\n", reqType)
+			b.write("if err := s.Recv(req); err != nil {\nreturn err\n}\n")
+			b.write("return d.Impl.")
+			b.writeIden(rpc.Iden)
+			b.writef("(ctx, req, %s)\n", stream)
+		}
+	}
+	b.write("}\n")
+	b.writef("return &lib.OrdErr{Type: %s, Ord: ord}\n", strconv.Quote(name))
+	b.write("}\n\n")
+}
+
+// buildStreamCall opens the stream of an rpc, sending the single request up front when only the results stream
+func (b *CodeBuilder) buildStreamCall(rpc MembNode, name string) {
+	b.writef("s, err := c.Invoker.Open(ctx, %sId, %d)\n", name, rpc.Ord)
+	b.write("if err != nil {\nreturn nil, err\n}\n")
+	if !rpc.LStream {
+		b.write("if err := s.Send(req); err != nil {\nreturn nil, err\n}\n")
+		b.write("if err := s.CloseSend(); err != nil {\nreturn nil, err\n}\n")
+	}
+	respType := b.typeName(rpc.RType)
+	b.writef("return lib.TypedStream[*%s, %s, *%s]{Stream: s}, nil\n", b.typeName(rpc.LType), respType, respType)
+	b.write("}\n\n")
+}
+
+// buildFile prepends the package clause and the imports collected while building the nodes, then formats the file
+func (b *CodeBuilder) buildFile(pack string) string {
+	var sb strings.Builder
+	sb.WriteString("// Code generated by brpc. DO NOT EDIT.\n\n")
+	sb.WriteString("package ")
+	sb.WriteString(pack)
+	sb.WriteString("\n\n")
+
+	var imports []string
+	for imp := range b.imports {
+		imports = append(imports, imp)
+	}
+	slices.Sort(imports)
+	if len(imports) > 0 {
+		sb.WriteString("import (\n")
+		for _, imp := range imports {
+			sb.WriteString(strconv.Quote(imp))
+			sb.WriteString("\n")
+		}
+		sb.WriteString(")\n\n")
+	}
+	sb.WriteString(b.sb.String())
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		panic(fmt.Sprintf("assertion error: generated code should be valid go: %v\n%s", err, sb.String()))
+	}
+	return string(src)
 }
 
 func runCodeBuilder(program string, pack string, errs *[]error) string {
+	imp := makeImporter(nil, os.ReadFile)
+	return Compile(program, "", pack, &imp, errs)
+}
+
+// Analyze parses and validates the program at path, returning its nodes with each type resolved
+func Analyze(program string, path string, imp *Importer, errs *[]error) []DefNode {
 	nodes := runParser(program, errs)
 
-	importTable := makeImportTable()
-	propTable := makePropTable(nodes)
+	table := makeTypeTable(nil)
+	imp.linkImports(nodes, path, table, errs)
 
 	tb := makeTransformer(errs)
-	tb.transformNodeList(nodes, nil)
+	tb.transformNodes(nodes, table)
 	tb.validateNodeList(nodes)
+	return nodes
+}
+
+// Compile generates the go source for the program at path in the given package, unless the program sets the package property
+// it returns an empty string if any errors other than warnings were emitted
+// imports are resolved relative to the directory of the program, an importer may be shared between programs so each import is loaded once
+func Compile(program string, path string, pack string, imp *Importer, errs *[]error) string {
+	nodes := Analyze(program, path, imp, errs)
+	propTable := makePropTable(nodes)
+	if propTable[PackageProp] != "" {
+		pack = propTable[PackageProp]
+	} else if !IsPackageName(pack) {
+		*errs = append(*errs, makePackageErr(pack))
+	}
 
-	if len(*errs) > 0 {
+	if HasErrors(*errs) {
 		return ""
 	}
 
-	cb := makeCodeBuilder(propTable, importTable, errs)
-	cb.buildPackage(pack)
+	cb := makeCodeBuilder(propTable, imp, pack, errs)
+	cb.nameNodes(nodes, "", nil)
 	cb.buildNodes(nodes)
+	cb.buildInstances()
+
+	if HasErrors(*errs) {
+		return ""
+	}
+	for _, key := range cb.added {
+		imp.built[key] = true
+	}
 
-	return cb.sb.String()
+	return cb.buildFile(pack)
 }
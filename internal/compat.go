@@ -0,0 +1,260 @@
+package internal
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// compatDef is a definition along with the file it is defined in
+type compatDef struct {
+	path  string
+	node  *DefNode
+	props PropTable // the properties of the file
+}
+
+type CompatChecker struct {
+	errs *[]error
+}
+
+func makeCompatChecker(errs *[]error) CompatChecker {
+	return CompatChecker{errs: errs}
+}
+
+func (c *CompatChecker) emitError(path string, err error) {
+	*c.errs = append(*c.errs, wrapFileErr(path, err))
+}
+
+// CheckCompat compares two versions of a set of validated files, keyed by path, reporting each change that prevents the new version from reading data written by the old
+// and warning about each field deprecated in the old version that the new version uses again
+// definitions are matched by name, and members by order tag as names are not on the wire, except enum cases and rpcs whose name is what they mean
+func CheckCompat(oldFiles ImportTable, newFiles ImportTable) []error {
+	var errs []error
+	c := makeCompatChecker(&errs)
+
+	newDefs := collectDefs(newFiles)
+	for _, oldDef := range sortedDefs(oldFiles) {
+		newDef, ok := newDefs[oldDef.node.Iden]
+		if !ok {
+			c.emitError(oldDef.path, makeRemovedCompatErr(oldDef.node.Positions, oldDef.node.Iden))
+			continue
+		}
+		if oldOrder, newOrder := byteOrder(oldDef.props), byteOrder(newDef.props); oldOrder != newOrder && newDef.node.Kind != ServiceNodeKind {
+			c.emitError(newDef.path, makeCompatErr(ByteOrderCompatKind, newDef.node.Positions, oldDef.node.Iden, oldOrder, newOrder))
+		}
+		c.checkDef(oldDef.node.Iden, oldDef, newDef)
+	}
+	return errs
+}
+
+// byteOrder is the byte order a file is encoded in
+func byteOrder(props PropTable) string {
+	if order, ok := props[ByteOrderProp]; ok {
+		return order
+	}
+	return "big"
+}
+
+func isDef(node *DefNode) bool {
+	return node.Kind == StructNodeKind || node.Kind == UnionNodeKind || node.Kind == EnumNodeKind || node.Kind == ServiceNodeKind
+}
+
+// sortedDefs lists the top level definitions of the files ordered by path, so changes are reported deterministically
+func sortedDefs(files ImportTable) []compatDef {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var defs []compatDef
+	for _, path := range paths {
+		nodes := files[path]
+		props := makePropTable(nodes)
+		for i := range nodes {
+			if isDef(&nodes[i]) {
+				defs = append(defs, compatDef{path: path, node: &nodes[i], props: props})
+			}
+		}
+	}
+	return defs
+}
+
+func collectDefs(files ImportTable) map[string]compatDef {
+	defs := make(map[string]compatDef)
+	for _, def := range sortedDefs(files) {
+		defs[def.node.Iden] = def
+	}
+	return defs
+}
+
+func (c *CompatChecker) checkDef(iden string, oldDef compatDef, newDef compatDef) {
+	if oldDef.node.Kind != newDef.node.Kind {
+		c.emitError(newDef.path, makeCompatErr(KindCompatKind, newDef.node.Positions, iden, oldDef.node.Kind.String(), newDef.node.Kind.String()))
+		return
+	}
+	if (oldDef.node.Kind == EnumNodeKind || oldDef.node.Kind == UnionNodeKind) && oldDef.node.Size != newDef.node.Size {
+		from := strconv.FormatUint(oldDef.node.Size, 10)
+		to := strconv.FormatUint(newDef.node.Size, 10)
+		c.emitError(newDef.path, makeCompatErr(WidthCompatKind, newDef.node.Positions, iden, from, to))
+	}
+
+	c.checkMembers(iden, oldDef, newDef)
+
+	for i := range oldDef.node.LocalDefs {
+		oldLocal := &oldDef.node.LocalDefs[i]
+		if !isDef(oldLocal) {
+			continue
+		}
+		localIden := iden + "." + oldLocal.Iden
+		newLocal := findDef(newDef.node.LocalDefs, oldLocal.Iden)
+		if newLocal == nil {
+			c.emitError(oldDef.path, makeRemovedCompatErr(oldLocal.Positions, localIden))
+			continue
+		}
+		c.checkDef(localIden, compatDef{path: oldDef.path, node: oldLocal, props: oldDef.props}, compatDef{path: newDef.path, node: newLocal, props: newDef.props})
+	}
+}
+
+func findDef(nodes []DefNode, iden string) *DefNode {
+	for i := range nodes {
+		if isDef(&nodes[i]) && nodes[i].Iden == iden {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+func findMember(nodes []MembNode, match func(MembNode) bool) (MembNode, bool) {
+	for _, node := range nodes {
+		if match(node) {
+			return node, true
+		}
+	}
+	return MembNode{}, false
+}
+
+// checkMembers matches fields and options by order tag, as their names are not on the wire
+// enum cases and rpcs are matched by name instead, a renumbered case or rpc would be read as a different one
+// new cases, options and rpcs are allowed but new fields are not
+func (c *CompatChecker) checkMembers(iden string, oldDef compatDef, newDef compatDef) {
+	kind := oldDef.node.MemberKind()
+	byName := kind == CaseNodeKind || kind == RpcNodeKind
+	var renumbered []string
+
+	for _, oldMemb := range oldDef.node.Members {
+		membIden := iden + "." + oldMemb.Iden
+		newMemb, ok := findMember(newDef.node.Members, func(m MembNode) bool { return m.Ord == oldMemb.Ord })
+		if byName || !ok {
+			newMemb, ok = findMember(newDef.node.Members, func(m MembNode) bool { return m.Iden == oldMemb.Iden })
+		}
+		if !ok {
+			c.emitError(oldDef.path, makeRemovedCompatErr(oldMemb.Positions, membIden))
+			continue
+		}
+		if newMemb.Ord != oldMemb.Ord {
+			from := strconv.FormatUint(oldMemb.Ord, 10)
+			to := strconv.FormatUint(newMemb.Ord, 10)
+			c.emitError(newDef.path, makeCompatErr(OrdCompatKind, newMemb.Positions, membIden, from, to))
+			renumbered = append(renumbered, newMemb.Iden)
+			if !byName {
+				continue
+			}
+		}
+
+		switch kind {
+		case FieldNodeKind:
+			if wireModifier(oldMemb.Modifier) != wireModifier(newMemb.Modifier) {
+				c.emitError(newDef.path, makeCompatErr(ModifierCompatKind, newMemb.Positions, membIden, oldMemb.Modifier.String(), newMemb.Modifier.String()))
+			} else if oldMemb.Modifier == Deprecated && newMemb.Modifier != Deprecated {
+				// still readable, but new code should not go back to relying on a field that was retired
+				c.emitError(newDef.path, makeDeprecatedCompatWarning(newMemb.Positions, membIden))
+			}
+			c.checkType(newDef.path, membIden, newMemb.Positions, oldMemb.LType, newMemb.LType)
+			c.checkLenWidth(newDef.path, membIden, oldMemb, newMemb)
+		case OptionNodeKind:
+			c.checkType(newDef.path, membIden, newMemb.Positions, oldMemb.LType, newMemb.LType)
+			c.checkLenWidth(newDef.path, membIden, oldMemb, newMemb)
+		case RpcNodeKind:
+			c.checkType(newDef.path, membIden, newMemb.Positions, oldMemb.LType, newMemb.LType)
+			c.checkType(newDef.path, membIden, newMemb.Positions, oldMemb.RType, newMemb.RType)
+			if oldKind, newKind := streamKind(oldMemb), streamKind(newMemb); oldKind != newKind {
+				c.emitError(newDef.path, makeCompatErr(StreamCompatKind, newMemb.Positions, membIden, oldKind, newKind))
+			}
+		}
+	}
+
+	if kind != FieldNodeKind {
+		return
+	}
+	for _, newMemb := range newDef.node.Members {
+		_, existed := findMember(oldDef.node.Members, func(m MembNode) bool { return m.Ord == newMemb.Ord })
+		if !existed && !slices.Contains(renumbered, newMemb.Iden) {
+			c.emitError(newDef.path, makeCompatErr(AddedCompatKind, newMemb.Positions, iden+"."+newMemb.Iden, "", ""))
+		}
+	}
+}
+
+// streamKind describes which sides of an rpc stream, the frames of a call depend on it
+func streamKind(rpc MembNode) string {
+	switch {
+	case rpc.LStream && rpc.RStream:
+		return "bidirectional streaming"
+	case rpc.LStream:
+		return "client streaming"
+	case rpc.RStream:
+		return "server streaming"
+	default:
+		return "unary"
+	}
+}
+
+// wireModifier is the modifier a field is encoded with, deprecated fields keep the slot of a required field
+func wireModifier(m Modifier) Modifier {
+	if m == Deprecated {
+		return Required
+	}
+	return m
+}
+
+// canonicalType spells each bit-width integer in a type the same way, so only changes to what is on the wire are reported
+func canonicalType(t TypeNode) TypeNode {
+	if t.Value.Bits > 0 {
+		t.Iden = t.Value.Name()
+	}
+	// sizes declared with constants are compared by their values
+	t.Consts = nil
+	args := make([]TypeNode, len(t.TypeArgs))
+	for i, arg := range t.TypeArgs {
+		args[i] = canonicalType(arg)
+	}
+	t.TypeArgs = args
+	return t
+}
+
+func (c *CompatChecker) checkType(path string, iden string, p Positions, oldType TypeNode, newType TypeNode) {
+	var oldSb, newSb strings.Builder
+	WriteType(&oldSb, canonicalType(oldType))
+	WriteType(&newSb, canonicalType(newType))
+	if oldSb.String() != newSb.String() {
+		c.emitError(path, makeCompatErr(TypeCompatKind, p, iden, oldSb.String(), newSb.String()))
+	}
+}
+
+// checkLenWidth reports a change to the width of the length prefixes of a member, which only matters if it has a variable length dimension or a map
+func (c *CompatChecker) checkLenWidth(path string, iden string, oldMemb MembNode, newMemb MembNode) {
+	if oldMemb.LenWidth == newMemb.LenWidth || !hasLenPrefix(newMemb.LType) {
+		return
+	}
+	from := strconv.FormatUint(oldMemb.LenWidth, 10)
+	to := strconv.FormatUint(newMemb.LenWidth, 10)
+	c.emitError(path, makeCompatErr(LenWidthCompatKind, newMemb.Positions, iden, from, to))
+}
+
+// hasLenPrefix reports whether a type is encoded with a length prefix anywhere within it, as variable length arrays and maps are
+func hasLenPrefix(t TypeNode) bool {
+	if slices.Contains(t.Array, 0) {
+		return true
+	}
+	return t.Value.Map
+}
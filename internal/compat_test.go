@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCompat(t *testing.T, oldProgram string, newProgram string) []error {
+	analyze := func(path string, program string) []DefNode {
+		var errs []error
+		imp := makeImporter(nil, mapReadFile(nil))
+		nodes := Analyze(program, path, &imp, &errs)
+		assert.False(t, HasErrors(errs))
+		return nodes
+	}
+
+	oldFiles := ImportTable{"old.brpc": analyze("old.brpc", oldProgram)}
+	newFiles := ImportTable{"new.brpc": analyze("new.brpc", newProgram)}
+	errs := CheckCompat(oldFiles, newFiles)
+
+	printLine := func(err string) { t.Log(err) }
+	PrintErrors(errs, "test", printLine)
+	clearErrors(errs)
+	return errs
+}
+
+func TestCompat_Changes(t *testing.T) {
+	oldProgram := `
+	message Game struct {
+		required id @1 int64;
+		optional board @2 Board;
+		required moves @3 []Move;
+		deprecated score @4 int8;
+		required tags @5 []string;
+	}
+
+	message Board struct {
+		required owners @1 map(b8, string);
+	}
+
+	message Move struct {
+		required row @1 int3;
+	}
+
+	message Color [4]enum {
+		@1 Red;
+		@2 Blue;
+		@3 Green;
+	}
+
+	message Piece union {
+		king @1 int8;
+		queen @2 string;
+	}
+
+	message Result enum {
+		@1 Win;
+	}
+
+	message Unused struct {}
+
+	service Games {
+		rpc @1 Get(Move) returns (Game)
+		rpc @2 Put(Game) returns (Move)
+		rpc @3 Watch(Move) returns (Game)
+	}
+	`
+
+	newProgram := `
+	message Game struct {
+		required ident @1 int64;
+		required board @2 Board;
+		required moves @3 []Move;
+		required score @4 int8;
+		required tags @5 []string [lenWidth = 16];
+		required extra @6 bool;
+	}
+
+	message Board struct {
+		required owners @1 map(b8, string) [lenWidth = 8];
+	}
+
+	message Move struct {
+		required row @1 int4;
+	}
+
+	message Color [8]enum {
+		@1 Red;
+		@2 Yellow;
+		@3 Blue;
+	}
+
+	message Piece union {
+		king @1 int8;
+		queen @2 []string;
+		pawn @3 bool;
+	}
+
+	message Result struct {}
+
+	service Games {
+		rpc @1 Get(Move) returns (Game)
+		rpc @2 Delete(Move) returns (Move)
+		rpc @3 Watch(Move) returns (stream Game)
+		rpc @4 Put(Game) returns (Move)
+	}
+	`
+
+	errs := runCompat(t, oldProgram, newProgram)
+
+	expectedErrs := []error{
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: ModifierCompatKind, iden: "Game.board", from: "optional", to: "required"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: DeprecatedCompatKind, iden: "Game.score", warn: true}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: LenWidthCompatKind, iden: "Game.tags", from: "32", to: "16"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: AddedCompatKind, iden: "Game.extra"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: LenWidthCompatKind, iden: "Board.owners", from: "32", to: "8"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: TypeCompatKind, iden: "Move.row", from: "int3", to: "int4"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: WidthCompatKind, iden: "Color", from: "4", to: "8"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: OrdCompatKind, iden: "Color.Blue", from: "2", to: "3"}},
+		&FileErr{path: "old.brpc", err: &CompatErr{eKind: RemovedCompatKind, iden: "Color.Green", old: true}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: TypeCompatKind, iden: "Piece.queen", from: "string", to: "[]string"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: KindCompatKind, iden: "Result", from: "enum", to: "struct"}},
+		&FileErr{path: "old.brpc", err: &CompatErr{eKind: RemovedCompatKind, iden: "Unused", old: true}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: OrdCompatKind, iden: "Games.Put", from: "2", to: "4"}},
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: StreamCompatKind, iden: "Games.Watch", from: "unary", to: "server streaming"}},
+	}
+	assert.Equal(t, expectedErrs, errs)
+}
+
+func TestCompat_ByteOrder(t *testing.T) {
+	oldProgram := `
+	message Game struct {
+		required id @1 int64;
+	}
+
+	service Games {
+		rpc @1 Get(Game) returns (Game)
+	}
+	`
+
+	newProgram := `
+	byteOrder = "little"
+
+	message Game struct {
+		required id @1 int64;
+	}
+
+	service Games {
+		rpc @1 Get(Game) returns (Game)
+	}
+	`
+
+	errs := runCompat(t, oldProgram, newProgram)
+
+	// services are not encoded themselves, so only the message is reported
+	expectedErrs := []error{
+		&FileErr{path: "new.brpc", err: &CompatErr{eKind: ByteOrderCompatKind, iden: "Game", from: "big", to: "little"}},
+	}
+	assert.Equal(t, expectedErrs, errs)
+}
+
+func TestCompat_Compatible(t *testing.T) {
+	oldProgram := `
+	message Game struct {
+		required id @1 int64;
+		required result @2 Result;
+		required turn @3 b1;
+		required board @4 [64]b2;
+
+		message Result [8]union {
+			win @1 bool;
+		}
+	}
+	`
+
+	// renaming members, deprecating fields, respelling integers, adding options, setting a prefix width on a field without arrays
+	// and declaring sizes with constants of the same value are all compatible
+	newProgram := `
+	const Cells = 64;
+	const Width = 8;
+
+	message Game struct {
+		deprecated ident @1 i64;
+		required outcome @2 Result;
+		required turn @3 u1 [lenWidth = 8];
+		required board @4 [Cells]b2;
+
+		message Result [Width]union {
+			won @1 bool;
+			draw @2 bool;
+		}
+	}
+	`
+
+	errs := runCompat(t, oldProgram, newProgram)
+	assert.Empty(t, errs)
+}
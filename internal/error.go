@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -58,11 +59,12 @@ func (err *ParseErr) withKind(kind NodeKind) ParserError {
 }
 
 func (err *ParseErr) Error() string {
-	var sb strings.Builder
+	return err.actual.Positions.Location() + " " + err.message()
+}
 
-	// header
-	sb.WriteString(err.actual.Positions.Offset())
-	sb.WriteRune(' ')
+// message describes the error without its position
+func (err *ParseErr) message() string {
+	var sb strings.Builder
 
 	// text
 	switch err.errKind {
@@ -106,6 +108,8 @@ func (err *ParseErr) Error() string {
 		sb.WriteString(": an ord must contain an '@' followed by an integer")
 	case TokInteger:
 		sb.WriteString(": an integer must only contain numeric characters")
+	case TokFloat:
+		sb.WriteString(": a float must have digits after its point and in its exponent")
 	default:
 	}
 
@@ -119,15 +123,39 @@ const (
 	UndefErrKind
 	FirstOrdErrKind
 	OrdErrKind
+	ImportErrKind
+	CycleErrKind
+	ArityErrKind
+	InstanceErrKind
+	RecursiveErrKind
+	OrdWidthErrKind
+	WidthErrKind
+	SpareWidthErrKind
+	PropErrKind
+	UnknownPropErrKind
+	MapKeyErrKind
+	DefaultTypeErrKind
+	DefaultErrKind
+	ConstErrKind
+	ConstTypeErrKind
+	ServiceTypeErrKind
+	ConstSizeErrKind
+	PackageErrKind
 )
 
 type TransformErr struct {
-	eKind  TransformErrKind
-	p      Positions
-	nKind  NodeKind
-	iden   string
-	expOrd uint64
-	gotOrd uint64
+	eKind   TransformErrKind
+	p       Positions
+	nKind   NodeKind
+	iden    string
+	expOrd  uint64
+	gotOrd  uint64
+	expArgs int
+	gotArgs int
+	bits    uint64
+	minBits uint64
+	value   string
+	warn    bool // warnings are reported, but do not stop code generation
 }
 
 func makeRedefErr(nKind NodeKind, p Positions, iden string) error {
@@ -142,10 +170,89 @@ func makeOrdErr(nKind NodeKind, p Positions, expOrd uint64, gotOrd uint64) error
 	return &TransformErr{eKind: OrdErrKind, p: p, nKind: nKind, expOrd: expOrd, gotOrd: gotOrd}
 }
 
+func makeImportErr(p Positions, path string) error {
+	return &TransformErr{eKind: ImportErrKind, p: p, nKind: ImportNodeKind, iden: path}
+}
+
+func makeCycleErr(p Positions, path string) error {
+	return &TransformErr{eKind: CycleErrKind, p: p, nKind: ImportNodeKind, iden: path}
+}
+
+func makeArityErr(nKind NodeKind, p Positions, iden string, expArgs int, gotArgs int) error {
+	return &TransformErr{eKind: ArityErrKind, p: p, nKind: nKind, iden: iden, expArgs: expArgs, gotArgs: gotArgs}
+}
+
+func makeInstanceErr(nKind NodeKind, p Positions, iden string) error {
+	return &TransformErr{eKind: InstanceErrKind, p: p, nKind: nKind, iden: iden}
+}
+
+func makeRecursiveErr(p Positions, iden string) error {
+	return &TransformErr{eKind: RecursiveErrKind, p: p, nKind: StructNodeKind, iden: iden}
+}
+
+func makeOrdWidthErr(nKind NodeKind, p Positions, ord uint64, bits uint64) error {
+	return &TransformErr{eKind: OrdWidthErrKind, p: p, nKind: nKind, gotOrd: ord, bits: bits}
+}
+
+func makeWidthErr(nKind NodeKind, p Positions, iden string, bits uint64) error {
+	return &TransformErr{eKind: WidthErrKind, p: p, nKind: nKind, iden: iden, bits: bits}
+}
+
+func makeSpareWidthWarning(nKind NodeKind, p Positions, iden string, bits uint64, minBits uint64) error {
+	return &TransformErr{eKind: SpareWidthErrKind, p: p, nKind: nKind, iden: iden, bits: bits, minBits: minBits, warn: true}
+}
+
+func makePropErr(p Positions, iden string, value string) error {
+	return &TransformErr{eKind: PropErrKind, p: p, nKind: PropertyNodeKind, iden: iden, value: value}
+}
+
+func makeUnknownPropErr(p Positions, iden string, known []string) error {
+	return &TransformErr{eKind: UnknownPropErrKind, p: p, nKind: PropertyNodeKind, iden: iden, value: strings.Join(known, ", ")}
+}
+
+func makeMapKeyErr(nKind NodeKind, p Positions, iden string) error {
+	return &TransformErr{eKind: MapKeyErrKind, p: p, nKind: nKind, iden: iden}
+}
+
+func makeDefaultTypeErr(p Positions, iden string) error {
+	return &TransformErr{eKind: DefaultTypeErrKind, p: p, nKind: FieldNodeKind, iden: iden}
+}
+
+func makeDefaultErr(p Positions, iden string, value string) error {
+	return &TransformErr{eKind: DefaultErrKind, p: p, nKind: FieldNodeKind, iden: iden, value: value}
+}
+
+func makeConstErr(nKind NodeKind, p Positions, iden string) error {
+	return &TransformErr{eKind: ConstErrKind, p: p, nKind: nKind, iden: iden}
+}
+
+func makeConstTypeErr(nKind NodeKind, p Positions, iden string) error {
+	return &TransformErr{eKind: ConstTypeErrKind, p: p, nKind: nKind, iden: iden}
+}
+
+func makeServiceTypeErr(nKind NodeKind, p Positions, iden string) error {
+	return &TransformErr{eKind: ServiceTypeErrKind, p: p, nKind: nKind, iden: iden}
+}
+
+func makeConstSizeErr(nKind NodeKind, p Positions, iden string, value string) error {
+	return &TransformErr{eKind: ConstSizeErrKind, p: p, nKind: nKind, iden: iden, value: value}
+}
+
+// makePackageErr reports the package given to the compiler, which has no position in the schema
+func makePackageErr(pack string) error {
+	return &TransformErr{eKind: PackageErrKind, nKind: PropertyNodeKind, value: pack}
+}
+
 func (err *TransformErr) Error() string {
+	return err.p.Location() + " " + err.message()
+}
+
+// message describes the error without its position
+func (err *TransformErr) message() string {
 	var sb strings.Builder
-	sb.WriteString(err.p.Offset())
-	sb.WriteRune(' ')
+	if err.warn {
+		sb.WriteString("warning: ")
+	}
 	sb.WriteString(err.nKind.String())
 	sb.WriteString(": ")
 
@@ -156,21 +263,205 @@ func (err *TransformErr) Error() string {
 		sb.WriteString(fmt.Sprintf("\"%s\" is undefined", err.iden))
 	case OrdErrKind:
 		sb.WriteString(fmt.Sprintf("order tag '@%d' should be '@%d'", err.gotOrd, err.expOrd))
+	case ImportErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" could not be found", err.iden))
+	case CycleErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is imported in a cycle", err.iden))
+	case ArityErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" expects %d type arguments, found %d", err.iden, err.expArgs, err.gotArgs))
+	case InstanceErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is instantiated with type arguments that grow without bound", err.iden))
+	case RecursiveErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" contains itself, a field it is contained through must be optional or a variable length array", err.iden))
+	case OrdWidthErrKind:
+		sb.WriteString(fmt.Sprintf("order tag '@%d' does not fit in %d bits", err.gotOrd, err.bits))
+	case WidthErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" has a width of %d bits, which exceeds 64 bits", err.iden, err.bits))
+	case SpareWidthErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" has a width of %d bits, but its order tags fit in %d bits", err.iden, err.bits, err.minBits))
+	case PropErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" has an invalid value \"%s\"", err.iden, err.value))
+	case UnknownPropErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is not a recognized property, expected one of %s", err.iden, err.value))
+	case MapKeyErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" cannot be a map key, keys must be enums or primitives of at most 64 bits", err.iden))
+	case DefaultTypeErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" cannot have a default, only primitives and enums can", err.iden))
+	case DefaultErrKind:
+		sb.WriteString(fmt.Sprintf("%s is not a valid default for \"%s\"", err.value, err.iden))
+	case ConstErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is not a constant", err.iden))
+	case ConstTypeErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is a constant, not a type", err.iden))
+	case ServiceTypeErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is a service, not a type", err.iden))
+	case PackageErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is not a valid go package name, set the package property to name the generated package", err.value))
+	case ConstSizeErrKind:
+		sb.WriteString(fmt.Sprintf("\"%s\" is %s, a size must be a positive integer", err.iden, err.value))
 	}
 
 	return sb.String()
 }
 
-func printErrors(errs []error, filePath string, printLine func(string)) {
+type CompatErrKind int
+
+const (
+	RemovedCompatKind CompatErrKind = iota
+	AddedCompatKind
+	KindCompatKind
+	WidthCompatKind
+	OrdCompatKind
+	ModifierCompatKind
+	TypeCompatKind
+	LenWidthCompatKind
+	ByteOrderCompatKind
+	StreamCompatKind
+	DeprecatedCompatKind
+)
+
+// CompatErr is a change between two versions of a schema that prevents the new version from reading data written by the old
+type CompatErr struct {
+	eKind CompatErrKind
+	p     Positions
+	iden  string // the qualified name of the definition or member that changed
+	from  string
+	to    string
+	old   bool // the position is in the old version of the schema, as what changed is not in the new version
+	warn  bool // warnings are reported, but the new version can still read data written by the old
+}
+
+func makeRemovedCompatErr(p Positions, iden string) error {
+	return &CompatErr{eKind: RemovedCompatKind, p: p, iden: iden, old: true}
+}
+
+func makeCompatErr(eKind CompatErrKind, p Positions, iden string, from string, to string) error {
+	return &CompatErr{eKind: eKind, p: p, iden: iden, from: from, to: to}
+}
+
+func makeDeprecatedCompatWarning(p Positions, iden string) error {
+	return &CompatErr{eKind: DeprecatedCompatKind, p: p, iden: iden, warn: true}
+}
+
+func (err *CompatErr) Error() string {
+	return err.p.Location() + " " + err.message()
+}
+
+// message describes the error without its position
+func (err *CompatErr) message() string {
+	switch err.eKind {
+	case RemovedCompatKind:
+		return fmt.Sprintf("\"%s\" was removed", err.iden)
+	case AddedCompatKind:
+		return fmt.Sprintf("\"%s\" was added, but data written by the old schema does not have it", err.iden)
+	case KindCompatKind:
+		return fmt.Sprintf("\"%s\" changed from %s to %s", err.iden, err.from, err.to)
+	case WidthCompatKind:
+		return fmt.Sprintf("\"%s\" changed width from %s to %s bits", err.iden, err.from, err.to)
+	case OrdCompatKind:
+		return fmt.Sprintf("\"%s\" changed order tag from '@%s' to '@%s'", err.iden, err.from, err.to)
+	case ModifierCompatKind:
+		return fmt.Sprintf("\"%s\" changed from %s to %s", err.iden, err.from, err.to)
+	case TypeCompatKind:
+		return fmt.Sprintf("\"%s\" changed type from %s to %s", err.iden, err.from, err.to)
+	case LenWidthCompatKind:
+		return fmt.Sprintf("\"%s\" changed length prefix width from %s to %s bits", err.iden, err.from, err.to)
+	case ByteOrderCompatKind:
+		return fmt.Sprintf("\"%s\" changed byte order from %s to %s endian", err.iden, err.from, err.to)
+	case StreamCompatKind:
+		return fmt.Sprintf("\"%s\" changed from a %s to a %s rpc", err.iden, err.from, err.to)
+	case DeprecatedCompatKind:
+		return fmt.Sprintf("warning: \"%s\" is deprecated in the old schema, but the new schema uses it again", err.iden)
+	default:
+		panic(fmt.Sprintf("assertion error: unknown compat errKind: %d", err.eKind))
+	}
+}
+
+// FileErr is an error in an imported file, rather than in the file being compiled
+type FileErr struct {
+	path string
+	err  error
+}
+
+func wrapFileErr(path string, err error) error {
+	if _, ok := err.(*FileErr); ok {
+		// errors from transitive imports already know which file they belong to
+		return err
+	}
+	return &FileErr{path: path, err: err}
+}
+
+func (err *FileErr) Error() string {
+	return fmt.Sprintf("%s:%s", err.path, err.err.Error())
+}
+
+func (err *FileErr) Unwrap() error {
+	return err.err
+}
+
+// IsWarning reports whether an error is only a warning, which does not stop code generation
+func IsWarning(err error) bool {
+	var transformErr *TransformErr
+	var compatErr *CompatErr
+	return errors.As(err, &transformErr) && transformErr.warn || errors.As(err, &compatErr) && compatErr.warn
+}
+
+// HasErrors reports whether any of the errors are not warnings
+func HasErrors(errs []error) bool {
 	for _, err := range errs {
+		if !IsWarning(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnostic is an error located at a range of byte offsets in a file
+type Diagnostic struct {
+	Positions
+	Path    string
+	Message string
+	Warning bool
+	Old     bool // the error is located in the old version of a schema
+}
+
+// MakeDiagnostic locates an error emitted while compiling the file at path, errors without a position are located at the start of the file
+func MakeDiagnostic(err error, path string) Diagnostic {
+	switch err := err.(type) {
+	case *ParseErr:
+		return Diagnostic{Positions: err.actual.Positions, Path: path, Message: err.message()}
+	case *TransformErr:
+		return Diagnostic{Positions: err.p, Path: path, Message: err.message(), Warning: err.warn}
+	case *CompatErr:
+		return Diagnostic{Positions: err.p, Path: path, Message: err.message(), Warning: err.warn, Old: err.old}
+	case *FileErr:
+		return MakeDiagnostic(err.err, err.path)
+	default:
+		return Diagnostic{Path: path, Message: err.Error()}
+	}
+}
+
+func PrintErrors(errs []error, filePath string, printLine func(string)) {
+	for _, err := range errs {
+		if _, ok := err.(*FileErr); ok {
+			printLine(err.Error())
+			continue
+		}
 		printLine(fmt.Sprintf("%s:%s", filePath, err.Error()))
 	}
 }
 
 func clearErrors(errs []error) {
 	for _, err := range errs {
-		if pErr, ok := err.(*ParseErr); ok {
-			pErr.actual.Positions = Positions{}
+		switch err := err.(type) {
+		case *ParseErr:
+			err.actual.Positions = Positions{}
+		case *TransformErr:
+			err.p = Positions{}
+		case *CompatErr:
+			err.p = Positions{}
+		case *FileErr:
+			clearErrors([]error{err.err})
 		}
 	}
 }
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+)
+
+type anchorKind int
+
+const (
+	startAnchor anchorKind = iota // where a node begins
+	openAnchor                    // where a definition with a body begins
+	endAnchor                     // where a node ends
+	closeAnchor                   // the closing brace of a definition
+)
+
+// anchor is a place in a program that comments are attached to, key is the offset the node it belongs to begins at
+type anchor struct {
+	pos  int
+	key  int
+	kind anchorKind
+}
+
+func collectAnchors(nodes []DefNode, anchors []anchor) []anchor {
+	for _, node := range nodes {
+		if isHeader(node) {
+			anchors = append(anchors, anchor{pos: node.B, key: node.B, kind: startAnchor})
+			anchors = append(anchors, anchor{pos: node.E, key: node.B, kind: endAnchor})
+			continue
+		}
+		anchors = append(anchors, anchor{pos: node.B, key: node.B, kind: openAnchor})
+		for _, member := range node.Members {
+			anchors = append(anchors, anchor{pos: member.B, key: member.B, kind: startAnchor})
+			anchors = append(anchors, anchor{pos: member.E, key: member.B, kind: endAnchor})
+		}
+		anchors = collectAnchors(node.LocalDefs, anchors)
+		anchors = append(anchors, anchor{pos: node.E - 1, key: node.B, kind: closeAnchor})
+		anchors = append(anchors, anchor{pos: node.E, key: node.B, kind: endAnchor})
+	}
+	return anchors
+}
+
+// attachComments attaches each comment to the node it is written on the same line after, otherwise to the node that follows it
+func attachComments(nodes []DefNode, comments []Token, program string) commentMap {
+	cm := commentMap{
+		leading:  make(map[int][]Token),
+		trailing: make(map[int][]Token),
+		opening:  make(map[int][]Token),
+		closing:  make(map[int][]Token),
+	}
+	anchors := collectAnchors(nodes, nil)
+	slices.SortStableFunc(anchors, func(a1, a2 anchor) int { return a1.pos - a2.pos })
+
+	for _, comment := range comments {
+		next, _ := slices.BinarySearchFunc(anchors, comment.B, func(a anchor, pos int) int { return a.pos - pos })
+
+		// a comment on the same line after where a node ends trails it, or after where a definition begins follows its opening brace
+		if prev := next - 1; prev >= 0 && !strings.Contains(program[anchors[prev].pos:comment.B], "\n") {
+			key := anchors[prev].key
+			switch anchors[prev].kind {
+			case endAnchor:
+				cm.trailing[key] = append(cm.trailing[key], comment)
+				continue
+			case openAnchor:
+				cm.opening[key] = append(cm.opening[key], comment)
+				continue
+			}
+		}
+		switch {
+		case next == len(anchors):
+			cm.footer = append(cm.footer, comment)
+		case anchors[next].kind == closeAnchor:
+			cm.closing[anchors[next].key] = append(cm.closing[anchors[next].key], comment)
+		default:
+			cm.leading[anchors[next].key] = append(cm.leading[anchors[next].key], comment)
+		}
+	}
+	return cm
+}
+
+// commentText strips the markers from a comment
+func commentText(comment Token) string {
+	text := strings.TrimPrefix(comment.Value, "//")
+	text = strings.TrimPrefix(text, " ")
+	return strings.TrimRight(text, whitespace)
+}
+
+// docText joins the leading comments that form a block ending on the line before line, comments separated by a blank line are not documentation
+func docText(leading []Token, line int) []string {
+	var lines []string
+	for i := len(leading) - 1; i >= 0 && leading[i].Line == line-1; i-- {
+		lines = append(lines, commentText(leading[i]))
+		line--
+	}
+	slices.Reverse(lines)
+	return lines
+}
+
+// attachDocs sets the documentation of each definition and member from the comments attached to it
+func attachDocs(nodes []DefNode, cm commentMap) {
+	for i := range nodes {
+		node := &nodes[i]
+		node.Doc = strings.Join(docText(cm.leading[node.B], node.Line), "\n")
+		for i := range node.Members {
+			member := &node.Members[i]
+			lines := docText(cm.leading[member.B], member.Line)
+			for _, comment := range cm.trailing[member.B] {
+				lines = append(lines, commentText(comment))
+			}
+			member.Doc = strings.Join(lines, "\n")
+		}
+		attachDocs(node.LocalDefs, cm)
+	}
+}
+
+// Format rewrites a program in a canonical layout, keeping its comments, returning an empty string if the program does not parse
+// definitions are separated by a blank line, members are indented with tabs and sorted by order tag, and local definitions follow the members
+func Format(program string, errs *[]error) string {
+	lex := makeLexer(program)
+	lex.run()
+
+	p := makeParser(lex.tokens, errs)
+	p.parse()
+	if len(*errs) > 0 {
+		return ""
+	}
+
+	w := makeAstWriter(attachComments(p.nodes, lex.comments, program))
+	w.writeNodeList(p.nodes, 0, false)
+	if len(p.nodes) > 0 && len(w.comments.footer) > 0 {
+		w.sb.WriteString("\n")
+	}
+	w.writeComments(w.comments.footer, 0)
+	return w.sb.String()
+}
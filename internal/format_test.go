@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	input := `// games between two players
+import "common"
+package="/hello/\\\"world\""
+const   Cells=64 ;
+  const Komi = -6.5;;
+   // a game in progress
+message Game struct {   // kept on the brace
+  optional result @2 Result; // set once the game ends
+      required moves @1 []Pair(int8,  Move) [ maxLen=64,lenWidth = "8" ];
+  required title @3 string="the \"final\""  [maxLen = 32];
+  optional komi @4 float32 =Komi [ lenWidth = Cells ];
+  required board @5 [Cells][ 2 ]b1;
+  message Result [ Width ]enum { @2 Draw; @1 Win; // the first player won
+  // more results to come
+  }
+} // end of game
+message Move struct {}
+message Pair struct(A,B){
+required first @1 A;
+required second @2 B;
+}
+service Games {
+	rpc @1 Get(Move) returns (Game)
+	rpc @2 Find( id  b128,int8 ) returns ( )
+	rpc @3 Watch(b128) returns (stream   Game)
+}
+// end of file
+`
+
+	expected := `// games between two players
+import "common"
+package = "/hello/\\\"world\""
+const Cells = 64;
+const Komi = -6.5;
+
+// a game in progress
+message Game struct { // kept on the brace
+	required moves @1 []Pair(int8, Move) [maxLen = 64, lenWidth = 8];
+	optional result @2 Result; // set once the game ends
+	required title @3 string = "the \"final\"" [maxLen = 32];
+	optional komi @4 float32 = Komi [lenWidth = Cells];
+	required board @5 [Cells][2]b1;
+
+	message Result [Width]enum {
+		@1 Win; // the first player won
+		@2 Draw;
+		// more results to come
+	}
+} // end of game
+
+message Move struct {}
+
+message Pair struct(A, B) {
+	required first @1 A;
+	required second @2 B;
+}
+
+service Games {
+	rpc @1 Get(Move) returns (Game)
+	rpc @2 Find(id b128, int8) returns ()
+	rpc @3 Watch(b128) returns (stream Game)
+}
+
+// end of file
+`
+
+	var errs []error
+	output := Format(input, &errs)
+	assert.Empty(t, errs)
+	assert.Equal(t, expected, output)
+
+	// formatting is idempotent
+	assert.Equal(t, expected, Format(output, &errs))
+	assert.Empty(t, errs)
+}
+
+func TestFormat_Errors(t *testing.T) {
+	var errs []error
+	output := Format("message Game struct {\n\trequired id @1;\n}\n", &errs)
+	assert.Equal(t, "", output)
+	assert.Len(t, errs, 1)
+}
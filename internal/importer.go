@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const SchemaExt = ".brpc"
+
+// Importer loads imported files, each file is parsed and validated once no matter how many times it is imported
+type Importer struct {
+	paths    []string
+	readFile func(string) ([]byte, error)
+	table    ImportTable
+	visiting []string        // the chain of files currently being imported, used to detect cycles
+	built    map[string]bool // the instantiations generated so far by package, so schemas generated into one package declare each once
+}
+
+func makeImporter(paths []string, readFile func(string) ([]byte, error)) Importer {
+	return Importer{paths: paths, readFile: readFile, table: makeImportTable(), built: make(map[string]bool)}
+}
+
+// NewImporter creates an importer which searches for imports in each of the paths, reading them with readFile
+func NewImporter(paths []string, readFile func(string) ([]byte, error)) *Importer {
+	imp := makeImporter(paths, readFile)
+	return &imp
+}
+
+// find searches for an import in the directory of the importing file, then in each search path
+func (imp *Importer) find(iden string, dir string) (string, []byte, bool) {
+	candidates := []string{iden}
+	if !strings.HasSuffix(iden, SchemaExt) {
+		candidates = append(candidates, iden+SchemaExt)
+	}
+
+	dirs := append([]string{dir}, imp.paths...)
+	if filepath.IsAbs(iden) {
+		dirs = []string{""}
+	}
+
+	for _, dir := range dirs {
+		for _, candidate := range candidates {
+			path := filepath.Clean(filepath.Join(dir, candidate))
+			program, err := imp.readFile(path)
+			if err == nil {
+				return path, program, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// linkImports resolves the imports of the file at path, inserting the top level definitions of each imported file into table
+func (imp *Importer) linkImports(nodes []DefNode, path string, table *TypeTable, errs *[]error) {
+	imp.visiting = append(imp.visiting, filepath.Clean(path))
+	defer func() { imp.visiting = imp.visiting[:len(imp.visiting)-1] }()
+
+	for _, node := range nodes {
+		if node.Kind != ImportNodeKind || node.Poisoned {
+			continue
+		}
+		imported, ok := imp.load(node, filepath.Dir(path), errs)
+		if !ok {
+			continue
+		}
+		for i := range imported {
+			def := &imported[i]
+			if def.Kind != StructNodeKind && def.Kind != UnionNodeKind && def.Kind != EnumNodeKind && def.Kind != ServiceNodeKind && def.Kind != ConstNodeKind {
+				continue
+			}
+			if err := table.insert(def.Iden, def); err != nil {
+				// the definition belongs to another file, so the error is reported at the import
+				*errs = append(*errs, makeRedefErr(ImportNodeKind, node.Positions, def.Iden))
+			}
+		}
+	}
+}
+
+func (imp *Importer) load(node DefNode, dir string, errs *[]error) ([]DefNode, bool) {
+	path, program, ok := imp.find(node.Value, dir)
+	if !ok {
+		*errs = append(*errs, makeImportErr(node.Positions, node.Value))
+		return nil, false
+	}
+	if slices.Contains(imp.visiting, path) {
+		*errs = append(*errs, makeCycleErr(node.Positions, node.Value))
+		return nil, false
+	}
+	if nodes, ok := imp.table[path]; ok {
+		return nodes, true
+	}
+
+	// errors in the imported file are attributed to its own path
+	var fileErrs []error
+	nodes := runParser(string(program), &fileErrs)
+
+	table := makeTypeTable(nil)
+	imp.linkImports(nodes, path, table, &fileErrs)
+
+	tb := makeTransformer(&fileErrs)
+	tb.transformNodes(nodes, table)
+	tb.validateNodeList(nodes)
+
+	for _, err := range fileErrs {
+		*errs = append(*errs, wrapFileErr(path, err))
+	}
+	imp.table[path] = nodes
+	return nodes, true
+}
@@ -17,6 +17,7 @@ const (
 	// TokIden etc. represent "variable" data that may need to be parsed later
 	TokIden
 	TokInteger
+	TokFloat
 	TokString
 	TokOrd
 
@@ -30,6 +31,7 @@ const (
 	TokLBrack
 	TokRBrack
 	TokEqual
+	TokMinus
 
 	// TokRequired etc., are "literal" tokens which represent extract symbols for controlling AST creation
 	TokRequired
@@ -39,10 +41,12 @@ const (
 	TokUnion
 	TokEnum
 	TokReturns
+	TokStream
 	TokRpc
 	TokImport
 	TokMessage
 	TokService
+	TokConst
 
 	// TokComment can be an "expected" token, but is never emitted for the parser to consume
 	TokComment
@@ -67,6 +71,8 @@ func (k TokKind) String() string {
 		return "iden"
 	case TokInteger:
 		return "integer"
+	case TokFloat:
+		return "float"
 	case TokString:
 		return "string"
 	case TokOrd:
@@ -89,10 +95,14 @@ func (k TokKind) String() string {
 		return "']'"
 	case TokEqual:
 		return "'='"
+	case TokMinus:
+		return "'-'"
 	case TokMessage:
 		return "message"
 	case TokService:
 		return "service"
+	case TokConst:
+		return "const"
 	case TokRequired:
 		return "required"
 	case TokOptional:
@@ -107,6 +117,8 @@ func (k TokKind) String() string {
 		return "enum"
 	case TokReturns:
 		return "returns"
+	case TokStream:
+		return "stream"
 	case TokRpc:
 		return "rpc"
 	case TokImport:
@@ -156,26 +168,37 @@ func (t Token) String() string {
 }
 
 type Lexer struct {
-	input  string
-	prev   rune
-	curr   int
-	start  int
-	width  int
-	tokens []Token
+	input     string
+	prev      rune
+	curr      int
+	start     int
+	width     int
+	line      int
+	lineStart int // offset of the first byte of the line
+	scanned   int // offset lines have been counted up to
+	tokens    []Token
+	comments  []Token // comments are kept apart from the tokens, as only the formatter uses them
 }
 
 const eof = 0
 
 func makeLexer(input string) Lexer {
-	return Lexer{input: input, tokens: make([]Token, 0)}
+	return Lexer{input: input, line: 1, tokens: make([]Token, 0)}
 }
 
 func (lex *Lexer) span() string {
 	return lex.input[lex.start:lex.curr]
 }
 
+// makePositions locates the span, lines are counted incrementally since spans are emitted in order
 func (lex *Lexer) makePositions() Positions {
-	return Positions{B: lex.start, E: lex.curr}
+	for ; lex.scanned < lex.start; lex.scanned++ {
+		if lex.input[lex.scanned] == '\n' {
+			lex.line++
+			lex.lineStart = lex.scanned + 1
+		}
+	}
+	return Positions{B: lex.start, E: lex.curr, Line: lex.line, Col: lex.start - lex.lineStart + 1}
 }
 
 func (lex *Lexer) emit(kind TokKind) {
@@ -207,10 +230,14 @@ func (lex *Lexer) emitText() {
 		kind = TokDeprecated
 	case "returns":
 		kind = TokReturns
+	case "stream":
+		kind = TokStream
 	case "rpc":
 		kind = TokRpc
 	case "import":
 		kind = TokImport
+	case "const":
+		kind = TokConst
 	}
 
 	lex.tokens = append(lex.tokens, Token{TokVal{Kind: kind, Value: str}, lex.makePositions()})
@@ -309,13 +336,36 @@ func (lex *Lexer) run() {
 	}
 }
 
-func (lex *Lexer) lexInteger() {
+// lexNumber lexes an integer, or a float if the digits are followed by a fraction or an exponent
+// the sign of a negative number is lexed as its own token
+func (lex *Lexer) lexNumber() {
 	kind := TokInteger
 	lex.acceptWhile(numeric)
+	if lex.accept(".") {
+		kind = TokFloat
+		if !lex.accept(numeric) {
+			lex.emitErr(kind)
+			return
+		}
+		lex.acceptWhile(numeric)
+	}
+	if lex.accept("eE") {
+		kind = TokFloat
+		lex.accept("+-")
+		if !lex.accept(numeric) {
+			lex.emitErr(kind)
+			return
+		}
+		lex.acceptWhile(numeric)
+	}
 	if !lex.assert(whitespace + control) {
 		lex.emitErr(kind)
 		return
 	}
+	if kind == TokFloat {
+		lex.emit(kind)
+		return
+	}
 
 	numStr := lex.span()
 	num, err := strconv.ParseUint(numStr, 10, 64)
@@ -333,6 +383,8 @@ func (lex *Lexer) lexComment() {
 		return
 	}
 	lex.acceptUntil(newline)
+	value := lex.span()
+	lex.comments = append(lex.comments, Token{TokVal{Kind: TokComment, Value: value}, lex.makePositions()})
 	lex.skip()
 }
 
@@ -412,6 +464,8 @@ func (lex *Lexer) lex() bool {
 		lex.emitNext(TokSemicolon)
 	case ',':
 		lex.emitNext(TokComma)
+	case '-':
+		lex.emitNext(TokMinus)
 	case '/':
 		lex.lexComment()
 	case '@':
@@ -420,7 +474,7 @@ func (lex *Lexer) lex() bool {
 		lex.lexString()
 	default:
 		if lex.accept(numeric) {
-			lex.lexInteger()
+			lex.lexNumber()
 		} else if !unicode.IsControl(ch) && !unicode.IsPunct(ch) && !unicode.IsSpace(ch) {
 			lex.lexText()
 		} else {
@@ -24,6 +24,7 @@ func TestLexer_Properties(t *testing.T) {
 
 	package = "/hello/\\\"world\""
 	constant = "typValue"
+	const Cells = 64;
 	`
 
 	tokens := runLexer(input)
@@ -37,6 +38,11 @@ func TestLexer_Properties(t *testing.T) {
 		{Kind: TokIden, Value: "constant"},
 		{Kind: TokEqual, Value: "="},
 		{Kind: TokString, Value: "\"typValue\""},
+		{Kind: TokConst, Value: "const"},
+		{Kind: TokIden, Value: "Cells"},
+		{Kind: TokEqual, Value: "="},
+		{Kind: TokInteger, Value: "64", Num: 64},
+		{Kind: TokSemicolon, Value: ";"},
 		{Kind: TokEof},
 	}
 	assert.Equal(t, expTokens, tokens)
@@ -145,7 +151,7 @@ func TestLexer_Service(t *testing.T) {
 	input := `
 	service ThingService {
     	rpc @1 DoThis (input) returns (Output)
-		rpc @2 DoThat (In) returns (Out)
+		rpc @2 DoThat (In) returns (stream Out)
 	}
 	`
 	tokens := runLexer(input)
@@ -172,6 +178,7 @@ func TestLexer_Service(t *testing.T) {
 		{Kind: TokRParen, Value: ")"},
 		{Kind: TokReturns, Value: "returns"},
 		{Kind: TokLParen, Value: "("},
+		{Kind: TokStream, Value: "stream"},
 		{Kind: TokIden, Value: "Out"},
 		{Kind: TokRParen, Value: ")"},
 		{Kind: TokRBrace, Value: "}"},
@@ -263,3 +270,53 @@ func TestLexer_BadInteger(t *testing.T) {
 
 	assert.Equal(t, expTokens, tokens)
 }
+
+func TestLexer_Numbers(t *testing.T) {
+	input := `= -5 1.25 -2e-3 7E+2; 1. 3e 4.5x`
+	tokens := runLexer(input)
+
+	expTokens := []TokVal{
+		{Kind: TokEqual, Value: "="},
+		{Kind: TokMinus, Value: "-"},
+		{Kind: TokInteger, Value: "5", Num: 5},
+		{Kind: TokFloat, Value: "1.25"},
+		{Kind: TokMinus, Value: "-"},
+		{Kind: TokFloat, Value: "2e-3"},
+		{Kind: TokFloat, Value: "7E+2"},
+		{Kind: TokSemicolon, Value: ";"},
+		{Kind: TokErr, Value: "1.", Expected: TokFloat},
+		{Kind: TokErr, Value: "3e", Expected: TokFloat},
+		{Kind: TokErr, Value: "4.5x", Expected: TokFloat},
+		{Kind: TokEof},
+	}
+	assert.Equal(t, expTokens, tokens)
+}
+
+func TestLexer_Positions(t *testing.T) {
+	input := "message Data struct {\n\trequired one @1 []int8; // comment\n}"
+
+	lex := makeLexer(input)
+	lex.run()
+
+	var positions []Positions
+	for _, token := range lex.tokens {
+		positions = append(positions, token.Positions)
+	}
+
+	expPositions := []Positions{
+		{B: 0, E: 7, Line: 1, Col: 1},
+		{B: 8, E: 12, Line: 1, Col: 9},
+		{B: 13, E: 19, Line: 1, Col: 14},
+		{B: 20, E: 21, Line: 1, Col: 21},
+		{B: 23, E: 31, Line: 2, Col: 2},
+		{B: 32, E: 35, Line: 2, Col: 11},
+		{B: 36, E: 38, Line: 2, Col: 15},
+		{B: 39, E: 40, Line: 2, Col: 18},
+		{B: 40, E: 41, Line: 2, Col: 19},
+		{B: 41, E: 45, Line: 2, Col: 20},
+		{B: 45, E: 46, Line: 2, Col: 24},
+		{B: 58, E: 59, Line: 3, Col: 1},
+		{B: 59, E: 59, Line: 3, Col: 2},
+	}
+	assert.Equal(t, expPositions, positions)
+}
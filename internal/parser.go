@@ -27,6 +27,7 @@ func runParser(program string, errs *[]error) []DefNode {
 	p := makeParser(lex.tokens, errs)
 	p.parse()
 
+	attachDocs(p.nodes, attachComments(p.nodes, lex.comments, program))
 	return p.nodes
 }
 
@@ -150,9 +151,11 @@ func (p *Parser) parseRoot() (DefNode, error) {
 		node = p.parseImport()
 	case TokIden:
 		node = p.parseProperty()
+	case TokConst:
+		node = p.parseConst()
 	default:
 		p.eat()
-		err = makeExpectErr(token, TokMessage, TokService, TokImport, TokIden)
+		err = makeExpectErr(token, TokMessage, TokService, TokImport, TokConst, TokIden)
 	}
 
 	return node, err
@@ -176,23 +179,128 @@ func (p *Parser) parseProperty() DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: %s", err))
 	}
-	prop.B = token.B
+	prop.Begin(token.Positions)
 	prop.Iden = token.Value
 
 	if _, err := p.expect(TokEqual); err != nil {
 		return forwardErr(err)
 	}
 
-	str, err := p.parseString(&token)
-	if err != nil {
+	if err := p.parsePropValue(&prop); err != nil {
 		return forwardErr(err)
 	}
-	prop.E = token.E
-	prop.Value = str
 
 	return prop
 }
 
+// parsePropValue parses the value of a property, which is either a string, an integer or the name of a constant
+func (p *Parser) parsePropValue(prop *DefNode) ParserError {
+	token := p.peek()
+	switch token.Kind {
+	case TokInteger:
+		p.eat()
+		prop.Value = token.Value
+	case TokIden:
+		p.eat()
+		prop.Value = token.Value
+		prop.Literal = &Literal{Positions: token.Positions, Kind: TokIden, Value: token.Value}
+	default:
+		value, err := p.parseString(&token)
+		if err != nil {
+			return err
+		}
+		prop.Value = value
+	}
+	prop.E = token.E
+	return nil
+}
+
+func (p *Parser) parseConst() DefNode {
+	cnst := DefNode{Kind: ConstNodeKind}
+
+	forwardErr := func(err ParserError) DefNode {
+		cnst.E = err.token().E
+		cnst.Poisoned = true
+		err.addKind(ConstNodeKind)
+		p.skipUntilSentinel()
+		p.emitError(err)
+		return cnst
+	}
+
+	token, err := p.expect(TokConst)
+	if err != nil {
+		panic(fmt.Sprintf("assertion error: %s", err))
+	}
+	cnst.Begin(token.Positions)
+
+	if token, err = p.expect(TokIden); err != nil {
+		return forwardErr(err)
+	}
+	cnst.Iden = token.Value
+	if !validateMsgName(cnst.Iden) {
+		// constants are exported from the generated package, so they are named like messages
+		p.emitError(makeKindErr(token, IdenErrKind).withKind(ConstNodeKind))
+		cnst.Poisoned = true
+	}
+
+	if _, err := p.expect(TokEqual); err != nil {
+		return forwardErr(err)
+	}
+	if token := p.peek(); token.Kind == TokIden {
+		p.eat()
+		return forwardErr(makeExpectErr(token, TokInteger, TokFloat, TokString))
+	}
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return forwardErr(err)
+	}
+	cnst.Literal = &lit
+
+	firstToken, ok := p.eatWhile(TokSemicolon)
+	if !ok {
+		return forwardErr(makeExpectErr(firstToken, TokSemicolon))
+	}
+	cnst.E = firstToken.E
+
+	return cnst
+}
+
+// parseMemberProps parses the options of a member, a bracketed list of properties after its type
+func (p *Parser) parseMemberProps() ([]DefNode, ParserError) {
+	var props []DefNode
+	if p.peek().Kind != TokLBrack {
+		return props, nil
+	}
+	p.eat()
+
+	for {
+		token, err := p.expect(TokIden)
+		if err != nil {
+			return nil, err
+		}
+		prop := DefNode{Kind: PropertyNodeKind, Iden: token.Value}
+		prop.Begin(token.Positions)
+
+		if _, err := p.expect(TokEqual); err != nil {
+			return nil, err
+		}
+		if err := p.parsePropValue(&prop); err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+
+		if p.peek().Kind != TokComma {
+			break
+		}
+		p.eat()
+	}
+
+	if _, err := p.expect(TokRBrack); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
 var escSeqTable = map[rune]rune{'\\': '\\', 'n': '\n', '\t': '\t', 'f': '\f', 'r': '\r', '"': '"'}
 
 func (p *Parser) parseString(token *Token) (string, ParserError) {
@@ -249,7 +357,7 @@ func (p *Parser) parseImport() DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: %s", err))
 	}
-	imp.B = token.B
+	imp.Begin(token.Positions)
 
 	pathStr, err := p.parseString(&token)
 	if err != nil {
@@ -261,29 +369,37 @@ func (p *Parser) parseImport() DefNode {
 	return imp
 }
 
+// DefaultMSize is the width in bits of the ord of an enum or union that does not declare one
 const DefaultMSize = 16
 
-func (p *Parser) parseMessageSize(callKind NodeKind) (uint64, ParserError) {
+// parseMessageSize parses the width of an enum or union, either a number or the name of a constant
+func (p *Parser) parseMessageSize(callKind NodeKind) (uint64, string, ParserError) {
 	if token := p.peek(); token.Kind != TokLBrack {
-		return DefaultMSize, nil // defaults when size is not provided - struct will never use this
+		return 0, "", nil // the transformer decides the size when it is not provided - struct will never use this
 	}
 	p.eat()
 
-	token, err := p.expect(TokInteger)
-	if err != nil {
-		return 0, err
+	token := p.next()
+	if token.Kind != TokInteger && token.Kind != TokIden {
+		return 0, "", makeExpectErr(token, TokInteger, TokIden)
+	}
+	var size uint64
+	var sizeConst string
+	if token.Kind == TokInteger {
+		size = token.Num
+	} else {
+		sizeConst = token.Value
 	}
-	size := token.Num
 
 	if _, err := p.expect(TokRBrack); err != nil {
-		return 0, err
+		return 0, "", err
 	}
 
 	// if the next token is a struct, emit an error, but not return the error to caller, we wish to continue parsing
 	if p.peek().Kind == TokStruct {
 		p.emitError(makeKindErr(token, SizeErrKind).withKind(callKind))
 	}
-	return size, nil
+	return size, sizeConst, nil
 }
 
 func validateMsgName(name string) bool {
@@ -315,7 +431,7 @@ func (p *Parser) parseMessage() (DefNode, ParserError) {
 		p.emitError(makeKindErr(token, IdenErrKind).withKind(kind))
 	}
 
-	size, err := p.parseMessageSize(kind)
+	size, sizeConst, err := p.parseMessageSize(kind)
 	if err != nil {
 		return DefNode{}, err.withKind(kind)
 	}
@@ -334,6 +450,7 @@ func (p *Parser) parseMessage() (DefNode, ParserError) {
 		p.eat()
 		err = makeExpectErr(token, TokTypeDef).withKind(kind)
 	}
+	node.SizeConst = sizeConst
 
 	return node, err
 }
@@ -354,7 +471,7 @@ func (p *Parser) parseStruct(name string, nameOk bool) DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: in struct: %s", err))
 	}
-	strct.B = token.B
+	strct.Begin(token.Positions)
 
 	typeParams, err := p.parseTypeParams()
 	if err != nil {
@@ -411,7 +528,7 @@ func (p *Parser) parseField() MembNode {
 	var ord uint64
 
 	token = p.next()
-	field.B = token.B
+	field.Begin(token.Positions)
 
 	switch token.Kind {
 	case TokRequired:
@@ -440,6 +557,19 @@ func (p *Parser) parseField() MembNode {
 	}
 	field.LType = typ
 
+	if p.peek().Kind == TokEqual {
+		p.eat()
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return forwardErr(err)
+		}
+		field.Default = &lit
+	}
+
+	if field.Props, err = p.parseMemberProps(); err != nil {
+		return forwardErr(err)
+	}
+
 	firstToken, ok := p.eatWhile(TokSemicolon)
 	if !ok {
 		return forwardErr(makeExpectErr(firstToken, TokSemicolon))
@@ -465,7 +595,7 @@ func (p *Parser) parseUnion(name string, nameOk bool, size uint64) DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: in union: %s", err))
 	}
-	union.B = token.B
+	union.Begin(token.Positions)
 
 	typeParams, err := p.parseTypeParams()
 	if err != nil {
@@ -529,7 +659,7 @@ func (p *Parser) parseOption() MembNode {
 	if err != nil {
 		return forwardErr(err)
 	}
-	option.B = token.B
+	option.Begin(token.Positions)
 	option.Ord = ord
 
 	typ, err := p.parseType()
@@ -538,6 +668,10 @@ func (p *Parser) parseOption() MembNode {
 	}
 	option.LType = typ
 
+	if option.Props, err = p.parseMemberProps(); err != nil {
+		return forwardErr(err)
+	}
+
 	firstToken, ok := p.eatWhile(TokSemicolon)
 	if !ok {
 		return forwardErr(makeExpectErr(firstToken, TokSemicolon))
@@ -563,7 +697,7 @@ func (p *Parser) parseEnum(name string, nameOk bool, size uint64) DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: in enum: %s", err))
 	}
-	enum.B = token.B
+	enum.Begin(token.Positions)
 
 	if _, err := p.expect(TokLBrace); err != nil {
 		forwardErr(err)
@@ -607,7 +741,7 @@ func (p *Parser) parseCase() MembNode {
 		return forwardErr(err)
 	}
 	ec.Ord = ord
-	ec.B = token.B
+	ec.Begin(token.Positions)
 
 	token, err = p.expect(TokIden)
 	if err != nil {
@@ -624,19 +758,56 @@ func (p *Parser) parseCase() MembNode {
 	return ec
 }
 
-func (p *Parser) parseArraySize() (uint64, ParserError) {
+// parseLiteral parses a constant, a number with an optional sign, a string or an iden
+func (p *Parser) parseLiteral() (Literal, ParserError) {
 	token := p.next()
+	lit := Literal{Positions: token.Positions}
+
+	sign := ""
+	if token.Kind == TokMinus {
+		sign = "-"
+		token = p.next()
+		if token.Kind != TokInteger && token.Kind != TokFloat {
+			return lit, makeExpectErr(token, TokInteger, TokFloat)
+		}
+	}
+	lit.E = token.E
+	lit.Kind = token.Kind
+
 	switch token.Kind {
-	case TokInteger:
-		size := token.Num
+	case TokInteger, TokFloat:
+		lit.Value = sign + token.Value
+	case TokIden:
+		lit.Value = token.Value
+	case TokString:
+		p.prev()
+		value, err := p.parseString(&token)
+		if err != nil {
+			return lit, err
+		}
+		lit.Value = value
+	default:
+		return lit, makeExpectErr(token, TokInteger, TokFloat, TokString, TokIden)
+	}
+	return lit, nil
+}
+
+// parseArraySize parses the size of a fixed dimension, either a number or the name of a constant, or nothing for a variable dimension
+func (p *Parser) parseArraySize() (uint64, string, ParserError) {
+	token := p.next()
+	switch token.Kind {
+	case TokInteger, TokIden:
 		if _, err := p.expect(TokRBrack); err != nil {
-			return 0, err
+			return 0, "", err
 		}
-		return size, nil
+		if token.Kind == TokIden {
+			return 0, token.Value, nil
+		}
+		return token.Num, "", nil
 	case TokRBrack:
-		return 0, nil
+		return 0, "", nil
 	default:
-		return 0, makeExpectErr(token, TokInteger, TokRBrack)
+		return 0, "", makeExpectErr(token, TokInteger, TokIden, TokRBrack)
 	}
 }
 
@@ -694,10 +865,12 @@ func (p *Parser) parseTypeArgs(token *Token) ([]TypeNode, ParserError) {
 		p.eat()
 	}
 
-	if _, err := p.expect(TokRParen); err != nil {
+	rParen, err := p.expect(TokRParen)
+	if err != nil {
 		*token = p.next()
 		return nil, err
 	}
+	*token = rParen
 
 	return typeArgs, nil
 }
@@ -705,6 +878,7 @@ func (p *Parser) parseTypeArgs(token *Token) ([]TypeNode, ParserError) {
 func (p *Parser) parseType() (TypeNode, ParserError) {
 	// each element of the array is a nested array index
 	var array []uint64
+	var consts []string
 	var arrTokenB Token
 
 	forwardErr := func(err ParserError) (TypeNode, ParserError) {
@@ -721,20 +895,21 @@ func (p *Parser) parseType() (TypeNode, ParserError) {
 				// if begin token is unset, we know we're at the first array token
 				arrTokenB = token
 			}
-			size, err := p.parseArraySize()
+			size, sizeConst, err := p.parseArraySize()
 			if err != nil {
 				return forwardErr(err)
 			}
 			array = append(array, size)
+			consts = append(consts, sizeConst)
 		case TokIden:
 			name := token.Value
 
 			// select the beginning token depending on whether the type ref is an array or not
 			var tokenB = token
-			if arrTokenB.Kind == TokUnknown {
+			if arrTokenB.Kind != TokUnknown {
 				tokenB = arrTokenB
 			}
-			tokenE := tokenB
+			tokenE := token
 
 			typeArgs, err := p.parseTypeArgs(&tokenE)
 			if err != nil {
@@ -744,7 +919,10 @@ func (p *Parser) parseType() (TypeNode, ParserError) {
 				Iden:      name,
 				Array:     array,
 				TypeArgs:  typeArgs,
-				Positions: Positions{B: tokenB.B, E: tokenE.E},
+				Positions: Positions{B: tokenB.B, E: tokenE.E, Line: tokenB.Line, Col: tokenB.Col},
+			}
+			if slices.ContainsFunc(consts, func(c string) bool { return c != "" }) {
+				node.Consts = consts
 			}
 			return node, nil
 		default:
@@ -787,6 +965,7 @@ func (p *Parser) parseService() DefNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: in service: %s", err))
 	}
+	svc.Begin(token.Positions)
 
 	token, err = p.expect(TokIden)
 	if err != nil {
@@ -814,6 +993,7 @@ func (p *Parser) parseService() DefNode {
 			}
 			svc.LocalDefs = append(svc.LocalDefs, message)
 		case TokRBrace:
+			svc.E = token.E
 			return svc
 		default:
 			forwardErr(makeExpectErr(token, TokRpc, TokMessage, TokRBrace))
@@ -840,7 +1020,7 @@ func (p *Parser) parseRpc() MembNode {
 	if err != nil {
 		panic(fmt.Sprintf("assertion error: in rpc: %s", err))
 	}
-	rpc.B = token.B
+	rpc.Begin(token.Positions)
 
 	ord, err := p.parseOrd()
 	if err != nil {
@@ -857,27 +1037,70 @@ func (p *Parser) parseRpc() MembNode {
 		return forwardErr(err)
 	}
 
-	typ, err := p.parseType()
-	if err != nil {
+	rpc.LStream = p.parseStream()
+	if rpc.LType, rpc.Params, err = p.parseRpcList(rpc.LStream); err != nil {
 		return forwardErr(err)
 	}
-	rpc.LType = typ
 
-	if err = p.expectChain(TokRParen, TokReturns, TokLParen); err != nil {
+	if err = p.expectChain(TokReturns, TokLParen); err != nil {
 		return forwardErr(err)
 	}
 
-	typ, err = p.parseType()
-	if err != nil {
+	rpc.RStream = p.parseStream()
+	if rpc.RType, rpc.Results, err = p.parseRpcList(rpc.RStream); err != nil {
 		return forwardErr(err)
 	}
-	rpc.RType = typ
+	rpc.E = p.tokens[p.curr-1].E
 
-	token, err = p.expect(TokRParen)
-	if err != nil {
-		return forwardErr(err)
+	return rpc
+}
+
+// parseStream eats the modifier that makes the parameters or results of an rpc a stream, if there is one
+func (p *Parser) parseStream() bool {
+	if p.peek().Kind != TokStream {
+		return false
 	}
-	rpc.E = token.E
+	p.eat()
+	return true
+}
 
-	return rpc
+// parseRpcList parses the parameters or results of an rpc up to the closing parenthesis
+// a single unnamed type is returned as is, any other list is returned as members, which may be named or left for the transformer to name
+// a stream needs at least one item, as there is nothing to send in a stream of nothing
+func (p *Parser) parseRpcList(stream bool) (TypeNode, []MembNode, ParserError) {
+	list := []MembNode{}
+	unnamed := true
+	for p.peek().Kind != TokRParen || (stream && len(list) == 0) {
+		if len(list) > 0 {
+			if _, err := p.expect(TokComma); err != nil {
+				return TypeNode{}, nil, err
+			}
+		}
+
+		item := MembNode{Modifier: Required, Ord: uint64(len(list) + 1)}
+		if p.peek().Kind == TokIden && (p.tokens[p.curr+1].Kind == TokIden || p.tokens[p.curr+1].Kind == TokLBrack) {
+			// a name is only followed by the type it names, an identifier is never the last token as the stream ends with eof
+			token := p.next()
+			item.Iden = token.Value
+			item.Begin(token.Positions)
+			unnamed = false
+		}
+
+		typ, err := p.parseType()
+		if err != nil {
+			return TypeNode{}, nil, err
+		}
+		if item.Iden == "" {
+			item.Begin(typ.Positions)
+		}
+		item.E = typ.E
+		item.LType = typ
+		list = append(list, item)
+	}
+	p.eat()
+
+	if len(list) == 1 && unnamed {
+		return list[0].LType, nil, nil
+	}
+	return TypeNode{}, list, nil
 }
@@ -61,8 +61,8 @@ func TestParser_Struct(t *testing.T) {
 			Kind: StructNodeKind,
 			Iden: "Data1",
 			Members: []MembNode{
-				{Modifier: Required, Iden: "one", Ord: 1, LType: TypeNode{Iden: "int128"}},
-				{Modifier: Required, Iden: "two", Ord: 2, LType: TypeNode{Iden: "int5", Array: []uint64{0}}},
+				{Modifier: Required, Iden: "one", Ord: 1, LType: TypeNode{Iden: "int128"}, Doc: "this is the first comment"},
+				{Modifier: Required, Iden: "two", Ord: 2, LType: TypeNode{Iden: "int5", Array: []uint64{0}}, Doc: "this is the second comment"},
 				{Modifier: Optional, Iden: "three", Ord: 3, LType: TypeNode{Iden: "int4", Array: []uint64{16}}},
 				{Modifier: Optional, Iden: "four", Ord: 4, LType: TypeNode{Iden: "int4", Array: []uint64{0, 4, 0}}},
 			},
@@ -158,7 +158,6 @@ func TestParser_Union(t *testing.T) {
 				{
 					Kind: UnionNodeKind,
 					Iden: "Data",
-					Size: 16,
 					Members: []MembNode{
 						{Ord: 1, Iden: "one", LType: TypeNode{Iden: "B"}},
 						{Ord: 2, Iden: "two", LType: TypeNode{Iden: "C"}},
@@ -218,6 +217,271 @@ func TestParser_Service(t *testing.T) {
 	assert.Empty(t, errs)
 }
 
+func TestParser_RpcLists(t *testing.T) {
+	input := `
+	service Games {
+		rpc @1 MakeMove(move Move, cells [4]b2) returns (b8)
+		rpc @2 GetGame(b128) returns (ok bool, Game)
+		rpc @3 List() returns (games []Game)
+	}
+	`
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedNodes := []DefNode{
+		{
+			Kind: ServiceNodeKind,
+			Iden: "Games",
+			Members: []MembNode{
+				{
+					Ord:  1,
+					Iden: "MakeMove",
+					Params: []MembNode{
+						{Ord: 1, Iden: "move", LType: TypeNode{Iden: "Move"}},
+						{Ord: 2, Iden: "cells", LType: TypeNode{Iden: "b2", Array: []uint64{4}}},
+					},
+					RType: TypeNode{Iden: "b8"},
+				},
+				{
+					Ord:   2,
+					Iden:  "GetGame",
+					LType: TypeNode{Iden: "b128"},
+					Results: []MembNode{
+						{Ord: 1, Iden: "ok", LType: TypeNode{Iden: "bool"}},
+						{Ord: 2, LType: TypeNode{Iden: "Game"}},
+					},
+				},
+				{
+					Ord:     3,
+					Iden:    "List",
+					Params:  []MembNode{},
+					Results: []MembNode{{Ord: 1, Iden: "games", LType: TypeNode{Iden: "Game", Array: []uint64{0}}}},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, expectedNodes, nodes)
+	assert.Empty(t, errs)
+}
+
+func TestParser_Streams(t *testing.T) {
+	input := `
+	service Games {
+		rpc @1 Watch(b128) returns (stream Board)
+		rpc @2 Upload(stream move Move, at b8) returns (ok bool)
+		rpc @3 Play(stream Move) returns (stream Board)
+	}
+	`
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedNodes := []DefNode{
+		{
+			Kind: ServiceNodeKind,
+			Iden: "Games",
+			Members: []MembNode{
+				{Ord: 1, Iden: "Watch", LType: TypeNode{Iden: "b128"}, RType: TypeNode{Iden: "Board"}, RStream: true},
+				{
+					Ord:  2,
+					Iden: "Upload",
+					Params: []MembNode{
+						{Ord: 1, Iden: "move", LType: TypeNode{Iden: "Move"}},
+						{Ord: 2, Iden: "at", LType: TypeNode{Iden: "b8"}},
+					},
+					LStream: true,
+					Results: []MembNode{{Ord: 1, Iden: "ok", LType: TypeNode{Iden: "bool"}}},
+				},
+				{Ord: 3, Iden: "Play", LType: TypeNode{Iden: "Move"}, RType: TypeNode{Iden: "Board"}, LStream: true, RStream: true},
+			},
+		},
+	}
+
+	assert.Equal(t, expectedNodes, nodes)
+	assert.Empty(t, errs)
+}
+
+func TestParser_Docs(t *testing.T) {
+	input := `
+	// not documentation, as a blank line follows
+
+	// Color is the color of a piece
+	//
+	// it never changes
+	message Color enum {
+		// the first player
+		@1 Black;
+		@2 White; // the second player
+	}
+	`
+
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedNodes := []DefNode{
+		{
+			Kind: EnumNodeKind,
+			Iden: "Color",
+			Doc:  "Color is the color of a piece\n\nit never changes",
+			Members: []MembNode{
+				{Iden: "Black", Ord: 1, Doc: "the first player"},
+				{Iden: "White", Ord: 2, Doc: "the second player"},
+			},
+		},
+	}
+
+	assert.Equal(t, expectedNodes, nodes)
+	assert.Empty(t, errs)
+}
+
+func TestParser_MemberProps(t *testing.T) {
+	input := `
+	message Data struct {
+		required one @1 []int8 [maxLen = 64, lenWidth = "8"];
+	}
+
+	message Choice union {
+		one @1 [][]bool [lenWidth = 4];
+	}
+	`
+
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedNodes := []DefNode{
+		{
+			Kind: StructNodeKind,
+			Iden: "Data",
+			Members: []MembNode{
+				{
+					Iden:  "one",
+					Ord:   1,
+					LType: TypeNode{Iden: "int8", Array: []uint64{0}},
+					Props: []DefNode{
+						{Kind: PropertyNodeKind, Iden: "maxLen", Value: "64"},
+						{Kind: PropertyNodeKind, Iden: "lenWidth", Value: "8"},
+					},
+				},
+			},
+		},
+		{
+			Kind: UnionNodeKind,
+			Iden: "Choice",
+			Members: []MembNode{
+				{
+					Iden:  "one",
+					Ord:   1,
+					LType: TypeNode{Iden: "bool", Array: []uint64{0, 0}},
+					Props: []DefNode{{Kind: PropertyNodeKind, Iden: "lenWidth", Value: "4"}},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, expectedNodes, nodes)
+	assert.Empty(t, errs)
+}
+
+func TestParser_Defaults(t *testing.T) {
+	input := `
+	message Data struct {
+		required one @1 int8 = -5;
+		optional two @2 float64 = 2.5e-1 [maxLen = 4];
+		required three @3 string = "a\"b";
+		optional four @4 Color = Black;
+		required five @5 bool;
+		required six @6 int8 = - x;
+	}
+	`
+
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedMembers := []MembNode{
+		{Modifier: Required, Iden: "one", Ord: 1, LType: TypeNode{Iden: "int8"}, Default: &Literal{Kind: TokInteger, Value: "-5"}},
+		{
+			Modifier: Optional,
+			Iden:     "two",
+			Ord:      2,
+			LType:    TypeNode{Iden: "float64"},
+			Default:  &Literal{Kind: TokFloat, Value: "2.5e-1"},
+			Props:    []DefNode{{Kind: PropertyNodeKind, Iden: "maxLen", Value: "4"}},
+		},
+		{Modifier: Required, Iden: "three", Ord: 3, LType: TypeNode{Iden: "string"}, Default: &Literal{Kind: TokString, Value: "a\"b"}},
+		{Modifier: Optional, Iden: "four", Ord: 4, LType: TypeNode{Iden: "Color"}, Default: &Literal{Kind: TokIden, Value: "Black"}},
+		{Modifier: Required, Iden: "five", Ord: 5, LType: TypeNode{Iden: "bool"}},
+		{Modifier: Required, Iden: "six", Ord: 6, LType: TypeNode{Iden: "int8"}, Poisoned: true},
+	}
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, expectedMembers, nodes[0].Members)
+
+	clearErrors(errs)
+	assert.Equal(t, []error{
+		&ParseErr{actual: Token{TokVal: TokVal{Kind: TokIden, Value: "x"}}, nodeKind: FieldNodeKind, expected: []TokKind{TokInteger, TokFloat}},
+	}, errs)
+}
+
+func TestParser_Consts(t *testing.T) {
+	input := `
+	const Cells = 64;
+	const Komi = -6.5;
+	lenWidth = Width
+
+	message Color [Width]enum {
+		@1 Black;
+	}
+
+	message Board struct {
+		required cells @1 [Cells][2]b1 [maxLen = Cells];
+		required komi @2 float32 = Komi;
+	}
+
+	const Name = Other;
+	`
+
+	var errs []error
+	nodes := runParser(input, &errs)
+	ClearNodeList(nodes)
+
+	expectedNodes := []DefNode{
+		{Kind: ConstNodeKind, Iden: "Cells", Literal: &Literal{Kind: TokInteger, Value: "64"}},
+		{Kind: ConstNodeKind, Iden: "Komi", Literal: &Literal{Kind: TokFloat, Value: "-6.5"}},
+		{Kind: PropertyNodeKind, Iden: "lenWidth", Value: "Width", Literal: &Literal{Kind: TokIden, Value: "Width"}},
+		{
+			Kind:      EnumNodeKind,
+			Iden:      "Color",
+			SizeConst: "Width",
+			Members:   []MembNode{{Iden: "Black", Ord: 1}},
+		},
+		{
+			Kind: StructNodeKind,
+			Iden: "Board",
+			Members: []MembNode{
+				{
+					Iden:  "cells",
+					Ord:   1,
+					LType: TypeNode{Iden: "b1", Array: []uint64{0, 2}, Consts: []string{"Cells", ""}},
+					Props: []DefNode{{Kind: PropertyNodeKind, Iden: "maxLen", Value: "Cells", Literal: &Literal{Kind: TokIden, Value: "Cells"}}},
+				},
+				{Iden: "komi", Ord: 2, LType: TypeNode{Iden: "float32"}, Default: &Literal{Kind: TokIden, Value: "Komi"}},
+			},
+		},
+		{Kind: ConstNodeKind, Iden: "Name", Poisoned: true},
+	}
+	assert.Equal(t, expectedNodes, nodes)
+
+	// a constant is a number or a string, it cannot refer to another constant
+	clearErrors(errs)
+	assert.Equal(t, []error{
+		&ParseErr{actual: Token{TokVal: TokVal{Kind: TokIden, Value: "Other"}}, nodeKind: ConstNodeKind, expected: []TokKind{TokInteger, TokFloat, TokString}},
+	}, errs)
+}
+
 func TestParser_Errors(t *testing.T) {
 	type Test struct {
 		name  string
@@ -260,7 +524,6 @@ func TestParser_Errors(t *testing.T) {
 						{
 							Kind:     UnionNodeKind,
 							Poisoned: true,
-							Size:     16,
 							Iden:     "Data2",
 							LocalDefs: []DefNode{
 								{Kind: StructNodeKind, Poisoned: true, Iden: "Data3"},
@@ -321,7 +584,7 @@ func TestParser_Errors(t *testing.T) {
 				&ParseErr{
 					actual:   Token{TokVal{Kind: TokErr, Value: "5a", Expected: TokInteger}, Positions{}},
 					nodeKind: TypeNodeKind,
-					expected: []TokKind{TokInteger, TokRBrack},
+					expected: []TokKind{TokInteger, TokIden, TokRBrack},
 				},
 				&ParseErr{
 					actual:   Token{TokVal{Kind: TokIden, Value: "Data_1"}, Positions{}},
@@ -385,7 +648,6 @@ func TestParser_Errors(t *testing.T) {
 							Kind:     UnionNodeKind,
 							Poisoned: true,
 							Iden:     "Data4",
-							Size:     16,
 							Members: []MembNode{
 								{Iden: "One", Ord: 1},
 								{Poisoned: true, Ord: 2},
@@ -472,9 +734,29 @@ func TestParser_Errors(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "EmptyStream",
+			input: `service Data { rpc @1 Watch(Test) returns (stream) }`,
+			nodes: []DefNode{
+				{
+					Kind: ServiceNodeKind,
+					Iden: "Data",
+					Members: []MembNode{
+						{Poisoned: true, Iden: "Watch", Ord: 1, LType: TypeNode{Iden: "Test"}, RStream: true},
+					},
+				},
+			},
+			errs: []error{
+				&ParseErr{
+					actual:   Token{TokVal{Kind: TokRParen, Value: ")"}, Positions{}},
+					nodeKind: RpcNodeKind,
+					expected: []TokKind{TokTypeRef},
+				},
+			},
+		},
 		{
 			name:  "InvalidRpc",
-			input: `service Data { rpc @1 Hello(Test) (Output) required one @1 int128; rpc @2 World(Test1) returns () }`,
+			input: `service Data { rpc @1 Hello(Test) (Output) required one @1 int128; rpc @2 World(Test1) returns (,) }`,
 			nodes: []DefNode{
 				{
 					Kind:     ServiceNodeKind,
@@ -498,7 +780,7 @@ func TestParser_Errors(t *testing.T) {
 					expected: []TokKind{TokRpc, TokMessage, TokRBrace},
 				},
 				&ParseErr{
-					actual:   Token{TokVal{Kind: TokRParen, Value: ")"}, Positions{}},
+					actual:   Token{TokVal{Kind: TokComma, Value: ","}, Positions{}},
 					nodeKind: RpcNodeKind,
 					expected: []TokKind{TokTypeRef},
 				},
@@ -513,7 +795,7 @@ func TestParser_Errors(t *testing.T) {
 			ClearNodeList(nodes)
 
 			printLine := func(err string) { t.Log(err) }
-			printErrors(errs, "test", printLine)
+			PrintErrors(errs, "test", printLine)
 			clearErrors(errs)
 
 			assert.Equal(t, test.nodes, nodes)
@@ -1,25 +1,89 @@
 package internal
 
 import (
+	"go/token"
+	"math"
+	"math/big"
+	"math/bits"
 	"slices"
+	"strconv"
+	"strings"
 )
 
+// PackageProp sets the go package name of the generated file, overriding the package given to the compiler
+const PackageProp = "package"
+
+// GoImportProp sets the go import path the generated file is placed in, so schemas importing this one can refer to its definitions from another package
+const GoImportProp = "goImport"
+
+// OrdWidthProp sets the width of enums and unions declared without one, either a number of bits or "infer"
+const OrdWidthProp = "ordWidth"
+
+// LenWidthProp sets the width of the length prefix of variable length arrays, in a file or on a single member
+const LenWidthProp = "lenWidth"
+
+// MaxLenProp limits the length of the variable length arrays of a member, longer arrays fail to encode or decode
+const MaxLenProp = "maxLen"
+
+// DefaultLenWidth is the width of array length prefixes when no lenWidth property is set, the same as lib.LenBits
+const DefaultLenWidth = 32
+
+// ByteOrderProp sets the order in which the bytes of values wider than a byte are written, either "big" or "little"
+const ByteOrderProp = "byteOrder"
+
+// StringEncodingProp sets how strings are encoded, either "bytes" to write them unchecked or "utf8" to reject strings that are not valid utf-8
+const StringEncodingProp = "stringEncoding"
+
+// fileProps are the properties recognized at the top level of a file
+var fileProps = []string{PackageProp, GoImportProp, OrdWidthProp, LenWidthProp, ByteOrderProp, StringEncodingProp}
+
+// rpcOrdBits is the width of the order tag of an rpc in a frame header, the same as lib.OrdBits
+const rpcOrdBits = 16
+
+// spareBits is how much wider than its order tags a declared width may be before it is considered wasteful
+const spareBits = 8
+
 type Transformer struct {
-	errs *[]error
+	errs       *[]error
+	ordWidth   uint64
+	inferWidth bool
+	lenWidth   uint64
 }
 
 func makeTransformer(errs *[]error) Transformer {
-	return Transformer{errs: errs}
+	return Transformer{errs: errs, ordWidth: DefaultMSize, lenWidth: DefaultLenWidth}
 }
 
 func (t *Transformer) emitError(err error) {
 	*t.errs = append(*t.errs, err)
 }
 
-func (t *Transformer) transformNodeList(nodes []DefNode, prev *TypeTable) {
+// transformNodeList returns the table the nodes were inserted into, each node is given the table of its own local definitions
+func (t *Transformer) transformNodeList(nodes []DefNode, prev *TypeTable) *TypeTable {
 	table := makeTypeTable(prev)
+	t.transformNodes(nodes, table)
+	return table
+}
+
+// transformNodes inserts the nodes into an existing table, the root table may already contain imported definitions
+func (t *Transformer) transformNodes(nodes []DefNode, table *TypeTable) {
+	// constants are inserted first, so a property can be set to a constant declared after it
+	for i := range nodes {
+		if node := &nodes[i]; node.Kind == ConstNodeKind {
+			if err := table.insert(node.Iden, node); err != nil {
+				t.emitError(err)
+			}
+		}
+	}
+
 	for i := range nodes {
 		node := &nodes[i]
+		if node.Kind == PropertyNodeKind && !node.Poisoned {
+			if t.resolvePropConst(node, table) {
+				t.transformProp(node)
+			}
+			continue
+		}
 		if node.Kind != StructNodeKind && node.Kind != UnionNodeKind && node.Kind != EnumNodeKind && node.Kind != ServiceNodeKind {
 			continue
 		}
@@ -27,8 +91,9 @@ func (t *Transformer) transformNodeList(nodes []DefNode, prev *TypeTable) {
 		if err := table.insert(node.Iden, node); err != nil {
 			t.emitError(err)
 		}
-		node.TypeTable = table
-
+		if node.Kind == ServiceNodeKind {
+			t.lowerRpcs(node)
+		}
 		mKind := node.MemberKind()
 		for i := range node.Members {
 			node := &node.Members[i]
@@ -41,10 +106,106 @@ func (t *Transformer) transformNodeList(nodes []DefNode, prev *TypeTable) {
 			}
 		}
 
-		t.transformNodeList(node.LocalDefs, table)
+		node.TypeTable = t.transformNodeList(node.LocalDefs, table)
 	}
 }
 
+// transformProp applies the properties that change how the file is validated, and checks the values of those read by the code builder
+func (t *Transformer) transformProp(node *DefNode) {
+	switch node.Iden {
+	case OrdWidthProp:
+		if node.Value == "infer" {
+			t.inferWidth = true
+			return
+		}
+		if width, ok := t.parseWidthProp(node); ok {
+			t.ordWidth = width
+		}
+	case LenWidthProp:
+		if width, ok := t.parseWidthProp(node); ok {
+			t.lenWidth = width
+		}
+	case PackageProp:
+		if !IsPackageName(node.Value) {
+			t.emitError(makePropErr(node.Positions, node.Iden, node.Value))
+		}
+	case GoImportProp:
+		if node.Value == "" || strings.ContainsAny(node.Value, " \t\n\"\\") || strings.HasPrefix(node.Value, "/") || strings.HasSuffix(node.Value, "/") {
+			t.emitError(makePropErr(node.Positions, node.Iden, node.Value))
+		}
+	case ByteOrderProp:
+		if node.Value != "big" && node.Value != "little" {
+			t.emitError(makePropErr(node.Positions, node.Iden, node.Value))
+		}
+	case StringEncodingProp:
+		if node.Value != "bytes" && node.Value != "utf8" {
+			t.emitError(makePropErr(node.Positions, node.Iden, node.Value))
+		}
+	default:
+		t.emitError(makeUnknownPropErr(node.Positions, node.Iden, fileProps))
+	}
+}
+
+// resolvePropConst sets a property written as the name of a constant to the value of the constant, returning false if it cannot be resolved
+func (t *Transformer) resolvePropConst(prop *DefNode, table *TypeTable) bool {
+	if prop.Literal == nil {
+		return true
+	}
+	c := t.resolveConst(PropertyNodeKind, prop.Literal.Positions, prop.Literal.Value, table)
+	if c == nil {
+		return false
+	}
+	prop.Literal.Ref = c
+	prop.Value = c.Literal.Value
+	return true
+}
+
+// resolveConst returns the constant an iden refers to, or nil if the iden is undefined or names a definition
+func (t *Transformer) resolveConst(kind NodeKind, p Positions, iden string, table *TypeTable) *DefNode {
+	node := table.resolve(iden)
+	switch {
+	case node == nil:
+		t.emitError(makeUndefErr(kind, p, iden))
+		return nil
+	case node.Kind != ConstNodeKind:
+		t.emitError(makeConstErr(kind, p, iden))
+		return nil
+	case node.Literal == nil:
+		// the constant did not parse, which has already been reported
+		return nil
+	}
+	return node
+}
+
+// constSize returns the value of a constant used as the size of an array dimension or the width of a message, 0 if it is not a positive integer
+func (t *Transformer) constSize(kind NodeKind, p Positions, iden string, table *TypeTable) uint64 {
+	c := t.resolveConst(kind, p, iden, table)
+	if c == nil {
+		return 0
+	}
+	size, err := strconv.ParseUint(c.Literal.Value, 10, 64)
+	if c.Literal.Kind != TokInteger || err != nil || size == 0 {
+		t.emitError(makeConstSizeErr(kind, p, iden, literalString(*c.Literal)))
+		return 0
+	}
+	return size
+}
+
+// IsPackageName reports whether name can be the name of a go package
+func IsPackageName(name string) bool {
+	return token.IsIdentifier(name) && !token.IsKeyword(name)
+}
+
+// parseWidthProp parses a property whose value is a number of bits
+func (t *Transformer) parseWidthProp(node *DefNode) (uint64, bool) {
+	width, err := strconv.ParseUint(node.Value, 10, 64)
+	if err != nil || width == 0 || width > 64 {
+		t.emitError(makePropErr(node.Positions, node.Iden, node.Value))
+		return 0, false
+	}
+	return width, true
+}
+
 func sortMembers(fields []MembNode) {
 	slices.SortFunc(fields, func(n1, n2 MembNode) int { return int(n1.Ord - n2.Ord) })
 }
@@ -78,33 +239,267 @@ func (t *Transformer) checkDupMembers(kind NodeKind, nodes []MembNode) {
 	}
 }
 
-func (t *Transformer) checkMemberTypes(kind NodeKind, nodes []MembNode, table *TypeTable) {
+func (t *Transformer) checkMemberTypes(kind NodeKind, nodes []MembNode, table *TypeTable, params []string) {
 	if table == nil {
 		return
 	}
-	for _, node := range nodes {
-		checkType := func(typeVal Type) {
-			if typeVal.Primitive {
-				return
+	for i := range nodes {
+		node := &nodes[i]
+		switch kind {
+		case FieldNodeKind:
+			t.resolveType(kind, &node.LType, table, params)
+			t.checkDefault(*node, table)
+		case OptionNodeKind:
+			t.resolveType(kind, &node.LType, table, params)
+		case RpcNodeKind:
+			t.resolveType(kind, &node.LType, table, params)
+			t.resolveType(kind, &node.RType, table, params)
+		}
+	}
+}
+
+// resolveType links a type and each of its type arguments to the definition they refer to
+// type parameters in scope shadow definitions of the same name, and only definitions accept type arguments
+func (t *Transformer) resolveType(kind NodeKind, typ *TypeNode, table *TypeTable, params []string) {
+	typ.Value = makeType(typ.Iden)
+	for i, c := range typ.Consts {
+		if c != "" {
+			typ.Array[i] = t.constSize(kind, typ.Positions, c, table)
+		}
+	}
+
+	expArgs := 0
+	switch {
+	case typ.Value.Primitive:
+	case typ.Value.Map:
+		expArgs = 2
+	case slices.Contains(params, typ.Iden):
+		typ.Param = true
+	default:
+		refNode := table.resolve(typ.Iden)
+		if refNode == nil {
+			t.emitError(makeUndefErr(kind, typ.Positions, typ.Iden))
+			return
+		}
+		if refNode.Kind == ConstNodeKind {
+			t.emitError(makeConstTypeErr(kind, typ.Positions, typ.Iden))
+			return
+		}
+		if refNode.Kind == ServiceNodeKind {
+			t.emitError(makeServiceTypeErr(kind, typ.Positions, typ.Iden))
+			return
+		}
+		typ.Ref = refNode
+		expArgs = len(refNode.TypeParams)
+	}
+	if len(typ.TypeArgs) != expArgs {
+		t.emitError(makeArityErr(kind, typ.Positions, typ.Iden, expArgs, len(typ.TypeArgs)))
+		return
+	}
+
+	for i := range typ.TypeArgs {
+		t.resolveType(kind, &typ.TypeArgs[i], table, params)
+	}
+	if typ.Value.Map {
+		t.checkMapKey(kind, typ.TypeArgs[0])
+	}
+}
+
+// checkMapKey ensures the key of a map is a primitive or an enum, so it is comparable in go and keys can be sorted when encoding
+// integers wider than 64 bits are big integers in go, which are not comparable
+func (t *Transformer) checkMapKey(kind NodeKind, key TypeNode) {
+	if !key.Value.Primitive && !key.Value.Map && key.Ref == nil && !key.Param {
+		// an undefined key has already been reported
+		return
+	}
+	enum := key.Ref != nil && key.Ref.Kind == EnumNodeKind
+	narrow := key.Value.Primitive && key.Value.Bits <= 64
+	if len(key.Array) == 0 && (enum || narrow) {
+		return
+	}
+	var sb strings.Builder
+	WriteType(&sb, key)
+	t.emitError(makeMapKeyErr(kind, key.Positions, sb.String()))
+}
+
+// checkDefault ensures the default of a field is a value of its type, which must be a primitive or an enum
+// an iden names a constant unless the field is a bool or an enum, whose values are spelled with idens
+func (t *Transformer) checkDefault(field MembNode, table *TypeTable) {
+	lit, typ := field.Default, field.LType
+	if lit == nil || (!typ.Value.Primitive && !typ.Value.Map && typ.Ref == nil && !typ.Param) {
+		// an undefined type has already been reported
+		return
+	}
+	var sb strings.Builder
+	WriteType(&sb, typ)
+
+	enum := typ.Ref != nil && typ.Ref.Kind == EnumNodeKind
+	if len(typ.Array) > 0 || !(typ.Value.Primitive || enum) {
+		t.emitError(makeDefaultTypeErr(typ.Positions, sb.String()))
+		return
+	}
+	value := *lit
+	if lit.Kind == TokIden && !enum && typ.Value.Iden != "bool" {
+		c := t.resolveConst(FieldNodeKind, lit.Positions, lit.Value, table)
+		if c == nil {
+			return
+		}
+		lit.Ref = c
+		value = *c.Literal
+	}
+	if !validLiteral(value, typ) {
+		t.emitError(makeDefaultErr(lit.Positions, sb.String(), literalString(*lit)))
+	}
+}
+
+// validLiteral reports whether a literal is a value of a primitive or enum type, integers must fit in the width of the type
+func validLiteral(lit Literal, typ TypeNode) bool {
+	value := typ.Value
+	switch {
+	case typ.Ref != nil:
+		isCase := func(c MembNode) bool { return c.Iden == lit.Value }
+		return lit.Kind == TokIden && slices.ContainsFunc(typ.Ref.Members, isCase)
+	case value.Bits > 0:
+		n, ok := new(big.Int).SetString(lit.Value, 10)
+		if lit.Kind != TokInteger || !ok {
+			return false
+		}
+		lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(value.Bits))
+		if value.Signed {
+			hi.Rsh(hi, 1)
+			lo.Neg(hi)
+		}
+		return n.Cmp(lo) >= 0 && n.Cmp(hi) < 0
+	case value.Iden == "float32", value.Iden == "float64":
+		bitSize := 64
+		if value.Iden == "float32" {
+			bitSize = 32
+		}
+		_, err := strconv.ParseFloat(lit.Value, bitSize)
+		return (lit.Kind == TokInteger || lit.Kind == TokFloat) && err == nil
+	case value.Iden == "string":
+		return lit.Kind == TokString
+	case value.Iden == "bool":
+		return lit.Kind == TokIden && (lit.Value == "true" || lit.Value == "false")
+	}
+	return false
+}
+
+// checkWidth ensures the order tags of an enum or union fit in its width, deciding the width if none was declared
+func (t *Transformer) checkWidth(node *DefNode) {
+	var maxOrd uint64
+	for _, member := range node.Members {
+		maxOrd = max(maxOrd, member.Ord)
+	}
+	minBits := uint64(max(bits.Len64(maxOrd), 1))
+
+	switch {
+	case node.Size == 0 && t.inferWidth:
+		node.Size = minBits
+		return
+	case node.Size == 0:
+		node.Size = t.ordWidth
+	case node.Size > 64:
+		t.emitError(makeWidthErr(node.Kind, node.Positions, node.Iden, node.Size))
+		return
+	case node.Size > minBits+spareBits:
+		// a declared width may leave room for future order tags, but not this much room
+		t.emitError(makeSpareWidthWarning(node.Kind, node.Positions, node.Iden, node.Size, minBits))
+	}
+
+	for _, member := range node.Members {
+		if uint64(bits.Len64(member.Ord)) > node.Size {
+			t.emitError(makeOrdWidthErr(node.MemberKind(), member.Positions, member.Ord, node.Size))
+			break
+		}
+	}
+}
+
+// checkRpcOrds ensures the order tag of each rpc fits in the frames it is called with
+func (t *Transformer) checkRpcOrds(rpcs []MembNode) {
+	for _, rpc := range rpcs {
+		if uint64(bits.Len64(rpc.Ord)) > rpcOrdBits {
+			t.emitError(makeOrdWidthErr(RpcNodeKind, rpc.Positions, rpc.Ord, rpcOrdBits))
+		}
+	}
+}
+
+// checkMemberProps applies the options of each field or union option, which default to the properties of the file
+func (t *Transformer) checkMemberProps(nodes []MembNode, table *TypeTable) {
+	for i := range nodes {
+		node := &nodes[i]
+		node.LenWidth = t.lenWidth
+		var maxLen *DefNode
+		for j := range node.Props {
+			prop := &node.Props[j]
+			if !t.resolvePropConst(prop, table) {
+				continue
 			}
-			refNode := table.resolve(typeVal.Iden)
-			if refNode == nil {
-				err := makeUndefErr(kind, node.Positions, typeVal.Iden)
-				t.emitError(err)
-				return
+			switch prop.Iden {
+			case LenWidthProp:
+				if width, ok := t.parseWidthProp(prop); ok {
+					node.LenWidth = width
+				}
+			case MaxLenProp:
+				maxLen = prop
+			default:
+				t.emitError(makeUnknownPropErr(prop.Positions, prop.Iden, []string{LenWidthProp, MaxLenProp}))
 			}
 		}
-		switch kind {
-		case FieldNodeKind, OptionNodeKind:
-			checkType(node.LType.Value)
-		case RpcNodeKind:
-			checkType(node.LType.Value)
-			checkType(node.RType.Value)
+
+		if maxLen == nil {
+			continue
+		}
+		// the limit is checked once the width is known, as a length prefix must be able to hold it
+		n, err := strconv.ParseUint(maxLen.Value, 10, 64)
+		if err != nil || n == 0 || n > math.MaxUint64>>(64-node.LenWidth) {
+			t.emitError(makePropErr(maxLen.Positions, maxLen.Iden, maxLen.Value))
+			continue
+		}
+		node.MaxLen = n
+	}
+}
+
+// lowerRpcs replaces the parameters and results of each rpc that are not a single message with a local message of the service
+func (t *Transformer) lowerRpcs(svc *DefNode) {
+	for i := range svc.Members {
+		rpc := &svc.Members[i]
+		if rpc.Poisoned {
+			continue
 		}
+		lowerRpcList(svc, *rpc, rpc.Iden+"Request", "arg", &rpc.LType, rpc.Params)
+		lowerRpcList(svc, *rpc, rpc.Iden+"Response", "result", &rpc.RType, rpc.Results)
 	}
 }
 
+// lowerRpcList declares a struct with a required field for each item of the list, in order, and points typ at it
+// a single type that is not a message is wrapped too, and unnamed items are named by their position
+// the struct is positioned at the rpc, so a clash with another local definition is reported there
+func lowerRpcList(svc *DefNode, rpc MembNode, iden string, prefix string, typ *TypeNode, list []MembNode) {
+	if list == nil {
+		if value := makeType(typ.Iden); !value.Primitive && !value.Map && len(typ.Array) == 0 {
+			return
+		}
+		list = []MembNode{{Positions: typ.Positions, Modifier: Required, Ord: 1, LType: *typ}}
+	}
+
+	fields := slices.Clone(list)
+	for i := range fields {
+		if fields[i].Iden == "" {
+			fields[i].Iden = prefix + strconv.Itoa(i+1)
+		}
+	}
+	svc.LocalDefs = append(svc.LocalDefs, DefNode{Positions: rpc.Positions, Kind: StructNodeKind, Iden: iden, Members: fields})
+	*typ = TypeNode{Positions: rpc.Positions, Iden: iden}
+}
+
 func (t *Transformer) validateNodeList(nodes []DefNode) {
+	t.validateNodes(nodes, nil)
+	t.checkCycles(nodes)
+}
+
+// validateNodes checks the nodes with the type parameters of their enclosing definitions in scope
+func (t *Transformer) validateNodes(nodes []DefNode, params []string) {
 	for i := range nodes {
 		node := &nodes[i]
 		if node.Kind != StructNodeKind && node.Kind != UnionNodeKind && node.Kind != EnumNodeKind && node.Kind != ServiceNodeKind {
@@ -117,12 +512,158 @@ func (t *Transformer) validateNodeList(nodes []DefNode) {
 		t.checkMemberOrder(mKind, node.Members)
 		t.checkDupMembers(mKind, node.Members)
 
-		if node.Kind != EnumNodeKind {
+		if node.Kind == EnumNodeKind || node.Kind == UnionNodeKind {
+			if node.SizeConst != "" {
+				node.Size = t.constSize(node.Kind, node.Positions, node.SizeConst, node.TypeTable)
+			}
+			t.checkWidth(node)
+		}
+		if node.Kind == StructNodeKind || node.Kind == UnionNodeKind {
+			t.checkMemberProps(node.Members, node.TypeTable)
+		}
+		if node.Kind == ServiceNodeKind {
+			t.checkRpcOrds(node.Members)
+		}
+		if node.Kind == EnumNodeKind {
 			// enum nodes will never have LocalDefs or non-nil Type
 			continue
 		}
 
-		t.checkMemberTypes(mKind, node.Members, node.TypeTable)
-		t.validateNodeList(node.LocalDefs)
+		scope := append(slices.Clone(params), node.TypeParams...)
+		t.checkMemberTypes(mKind, node.Members, node.TypeTable, scope)
+		t.validateNodes(node.LocalDefs, scope)
+	}
+}
+
+// cycleChecker walks the structs each struct holds by value, generic structs are walked once per set of type arguments
+type cycleChecker struct {
+	t        *Transformer
+	outer    map[*DefNode][]string // the type parameters of the definitions enclosing each definition
+	ids      map[*DefNode]int      // distinguishes definitions sharing an identifier in keys
+	visiting map[string]bool       // the instantiations being walked, false once they are done
+	reported map[*DefNode]bool
+}
+
+// checkCycles reports structs that contain themselves through required or deprecated fields that are not variable length arrays
+func (t *Transformer) checkCycles(nodes []DefNode) {
+	c := cycleChecker{t: t, outer: make(map[*DefNode][]string), ids: make(map[*DefNode]int), visiting: make(map[string]bool), reported: make(map[*DefNode]bool)}
+	for i := range nodes {
+		c.recordOuter(&nodes[i], nil)
+	}
+	c.walkNodes(nodes)
+}
+
+func (c *cycleChecker) recordOuter(node *DefNode, params []string) {
+	c.outer[node] = params
+	scope := append(slices.Clone(params), node.TypeParams...)
+	for i := range node.LocalDefs {
+		c.recordOuter(&node.LocalDefs[i], scope)
+	}
+}
+
+// walkNodes walks every struct that is not generic, generic structs are only walked through their instantiations
+func (c *cycleChecker) walkNodes(nodes []DefNode) {
+	for i := range nodes {
+		node := &nodes[i]
+		if node.Kind == StructNodeKind && len(node.TypeParams) == 0 && len(c.outer[node]) == 0 {
+			c.walk(node, nil, 0)
+		}
+		c.walkNodes(node.LocalDefs)
+	}
+}
+
+func (c *cycleChecker) walk(node *DefNode, env map[string]TypeNode, depth int) {
+	key := c.key(node, env)
+	if visiting, ok := c.visiting[key]; ok {
+		if visiting && !c.reported[node] {
+			c.reported[node] = true
+			c.t.emitError(makeRecursiveErr(node.Positions, node.Iden))
+		}
+		return
+	}
+	if depth == maxInstanceDepth {
+		// instantiations that grow without bound are reported when the code is built
+		return
+	}
+
+	c.visiting[key] = true
+	for _, member := range node.Members {
+		if member.Modifier == Optional {
+			continue
+		}
+		typ := substitute(member.LType, env)
+		if typ.Ref == nil || typ.Ref.Kind != StructNodeKind || slices.Contains(typ.Array, 0) || len(typ.TypeArgs) != len(typ.Ref.TypeParams) {
+			continue
+		}
+		if _, ok := c.outer[typ.Ref]; !ok {
+			// the struct is declared in an imported schema
+			c.recordOuter(typ.Ref, nil)
+		}
+		refEnv := make(map[string]TypeNode)
+		for _, param := range c.outer[typ.Ref] {
+			refEnv[param] = env[param]
+		}
+		for i, param := range typ.Ref.TypeParams {
+			refEnv[param] = typ.TypeArgs[i]
+		}
+		c.walk(typ.Ref, refEnv, depth+1)
+	}
+	c.visiting[key] = false
+}
+
+// key identifies an instantiation of the node by the node and the types its parameters are bound to
+func (c *cycleChecker) key(node *DefNode, env map[string]TypeNode) string {
+	var sb strings.Builder
+	sb.WriteString(c.id(node))
+	for _, param := range append(slices.Clone(c.outer[node]), node.TypeParams...) {
+		sb.WriteString(" ")
+		c.writeTypeKey(&sb, env[param])
+	}
+	return sb.String()
+}
+
+func (c *cycleChecker) id(node *DefNode) string {
+	id, ok := c.ids[node]
+	if !ok {
+		id = len(c.ids)
+		c.ids[node] = id
+	}
+	return "#" + strconv.Itoa(id)
+}
+
+func (c *cycleChecker) writeTypeKey(sb *strings.Builder, typ TypeNode) {
+	for _, dim := range typ.Array {
+		sb.WriteString("[" + strconv.FormatUint(dim, 10) + "]")
+	}
+	if typ.Ref != nil {
+		sb.WriteString(c.id(typ.Ref))
+	} else {
+		sb.WriteString(typ.Iden)
+	}
+	sb.WriteString("(")
+	for _, arg := range typ.TypeArgs {
+		c.writeTypeKey(sb, arg)
+		sb.WriteString(",")
+	}
+	sb.WriteString(")")
+}
+
+// substitute replaces the type parameters in the type with the types they are bound to, unbound parameters resolve to no definition
+func substitute(typ TypeNode, env map[string]TypeNode) TypeNode {
+	if typ.Param {
+		arg, ok := env[typ.Iden]
+		if !ok {
+			return TypeNode{}
+		}
+		arg.Array = append(slices.Clone(typ.Array), arg.Array...)
+		return arg
+	}
+	if len(typ.TypeArgs) > 0 {
+		args := make([]TypeNode, len(typ.TypeArgs))
+		for i, arg := range typ.TypeArgs {
+			args[i] = substitute(arg, env)
+		}
+		typ.TypeArgs = args
 	}
+	return typ
 }
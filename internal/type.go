@@ -10,6 +10,38 @@ type Type struct {
 	Bits      int    // populated for bit-width integers intead of iden
 	Iden      string // populated for non-integer identifiers
 	Primitive bool
+	Signed    bool // bit-width integers are either two's complement or unsigned
+	Map       bool // the built-in map(K, V), whose key and value types are the type arguments
+}
+
+// MapIden names the built-in map type, which is neither a primitive nor a message
+const MapIden = "map"
+
+// intPrefixes maps the prefix of each family of bit-width integers to whether the family is signed
+var intPrefixes = []struct {
+	prefix string
+	signed bool
+}{
+	{"int", true},
+	{"i", true},
+	{"u", false},
+	{"b", false},
+}
+
+// parseInt parses a bit-width integer identifier, such as int5, i5, u5 or b5
+func parseInt(iden string) (bits int, signed bool, ok bool) {
+	for _, family := range intPrefixes {
+		bitsStr, found := strings.CutPrefix(iden, family.prefix)
+		if !found || bitsStr == "" || strings.TrimLeft(bitsStr, numeric) != "" {
+			continue
+		}
+		bits, err := strconv.Atoi(bitsStr)
+		if err != nil || bits == 0 {
+			return 0, false, false
+		}
+		return bits, family.signed, true
+	}
+	return 0, false, false
 }
 
 func isPrimitive(iden string) bool {
@@ -23,29 +55,33 @@ func isPrimitive(iden string) bool {
 	case "float64":
 		return true
 	}
-	isInt := len(iden) >= 3 && iden[0:2] == "int"
+	_, _, isInt := parseInt(iden)
 	return isInt
 }
 
 var IntSizes = []int{8, 16, 32, 64}
 
 func makeType(iden string) Type {
-	t := Type{Iden: iden, Primitive: isPrimitive(iden)}
-
-	index := strings.Index(iden, "int")
-	if index < 0 {
-		// does not contain int, so it cannot be a primitive
-		return t
+	if iden == MapIden {
+		return Type{Iden: iden, Map: true}
 	}
-	bitsStr := iden[index+3:]
-	bits, err := strconv.Atoi(bitsStr)
-	if err != nil {
-		// contains int, but does not contain a number
-		return t
+	bits, signed, ok := parseInt(iden)
+	if !ok {
+		return Type{Iden: iden, Primitive: isPrimitive(iden)}
 	}
+	return Type{Primitive: true, Bits: bits, Signed: signed}
+}
 
-	t = Type{Primitive: true, Bits: bits}
-	return t
+// Name is the canonical name of a type, each family of bit-width integers has a single spelling
+func (t Type) Name() string {
+	switch {
+	case t.Bits > 0 && t.Signed:
+		return fmt.Sprintf("int%d", t.Bits)
+	case t.Bits > 0:
+		return fmt.Sprintf("uint%d", t.Bits)
+	default:
+		return t.Iden
+	}
 }
 
 func (t Type) Native() string {
@@ -54,9 +90,13 @@ func (t Type) Native() string {
 	}
 
 	// map to a fix sized primitive, or a big integer if that is not possible
+	prefix := "int"
+	if !t.Signed {
+		prefix = "uint"
+	}
 	for _, size := range IntSizes {
 		if t.Bits <= size {
-			return fmt.Sprintf("int%d", size)
+			return fmt.Sprintf("%s%d", prefix, size)
 		}
 	}
 	return "big.Int"
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -9,16 +10,29 @@ func ClearNodeList(nodes []DefNode) {
 	for i := range nodes {
 		node := &nodes[i]
 		node.Clear()
-		for i := range node.Members {
-			node := &node.Members[i]
-			node.Clear()
-			ClearTypeNode(&node.LType)
-			ClearTypeNode(&node.RType)
+		if node.Literal != nil {
+			node.Literal.Clear()
 		}
+		clearMembers(node.Members)
 		ClearNodeList(node.LocalDefs)
 	}
 }
 
+func clearMembers(nodes []MembNode) {
+	for i := range nodes {
+		node := &nodes[i]
+		node.Clear()
+		ClearTypeNode(&node.LType)
+		ClearTypeNode(&node.RType)
+		ClearNodeList(node.Props)
+		clearMembers(node.Params)
+		clearMembers(node.Results)
+		if node.Default != nil {
+			node.Default.Clear()
+		}
+	}
+}
+
 func ClearTypeNode(node *TypeNode) {
 	node.Clear()
 	for i := range node.TypeArgs {
@@ -26,62 +40,206 @@ func ClearTypeNode(node *TypeNode) {
 	}
 }
 
+// commentMap attaches the comments of a program to the nodes they are next to, keyed by the offset each node begins at
+type commentMap struct {
+	leading  map[int][]Token // comments on the lines before a node
+	trailing map[int][]Token // a comment after a node on the same line
+	opening  map[int][]Token // a comment on the same line as the opening brace of a definition
+	closing  map[int][]Token // comments before the closing brace of a definition
+	footer   []Token         // comments after every node
+}
+
+// astWriter writes nodes back to text in a canonical layout, along with the comments attached to them
+type astWriter struct {
+	sb       strings.Builder
+	comments commentMap
+}
+
+func makeAstWriter(comments commentMap) astWriter {
+	return astWriter{comments: comments}
+}
+
 func WriteAst(nodes []DefNode) string {
-	var sb strings.Builder
-	WriteNodeList(&sb, nodes, 0)
-	return sb.String()
+	w := makeAstWriter(commentMap{})
+	w.writeNodeList(nodes, 0, false)
+	return w.sb.String()
 }
 
-func writeIndents(sb *strings.Builder, depth int) {
+func (w *astWriter) writeIndents(depth int) {
 	for range depth {
-		sb.WriteString("\t")
+		w.sb.WriteString("\t")
 	}
 }
 
-func WriteNodeList(sb *strings.Builder, nodes []DefNode, depth int) {
-	for _, node := range nodes {
-		if depth != 0 && (node.Kind == StructNodeKind || node.Kind == UnionNodeKind || node.Kind == EnumNodeKind) {
-			sb.WriteString("\n")
+func (w *astWriter) writeComments(comments []Token, depth int) {
+	for _, comment := range comments {
+		w.writeIndents(depth)
+		w.sb.WriteString(strings.TrimRight(comment.Value, whitespace))
+		w.sb.WriteString("\n")
+	}
+}
+
+func (w *astWriter) writeTrailing(comments []Token) {
+	for _, comment := range comments {
+		w.sb.WriteString(" ")
+		w.sb.WriteString(strings.TrimRight(comment.Value, whitespace))
+	}
+	w.sb.WriteString("\n")
+}
+
+func isHeader(node DefNode) bool {
+	return node.Kind == ImportNodeKind || node.Kind == PropertyNodeKind || node.Kind == ConstNodeKind
+}
+
+// writeNodeList separates definitions with a blank line, consecutive imports, properties and constants are kept together
+// sep separates the first node from what was written before it
+func (w *astWriter) writeNodeList(nodes []DefNode, depth int, sep bool) {
+	for i, node := range nodes {
+		if (i == 0 && sep) || (i > 0 && !(isHeader(node) && isHeader(nodes[i-1]))) {
+			w.sb.WriteString("\n")
 		}
+		w.writeComments(w.comments.leading[node.B], depth)
+		w.writeIndents(depth)
+
 		switch node.Kind {
 		case ImportNodeKind:
-			fmt.Fprintf(sb, "import \"%s\"\n", node.Value)
+			fmt.Fprintf(&w.sb, "import %s", quoteString(node.Value))
+			w.writeTrailing(w.comments.trailing[node.B])
+			continue
 		case PropertyNodeKind:
-			fmt.Fprintf(sb, "%s \"%s\"\n", node.Iden, node.Value)
+			fmt.Fprintf(&w.sb, "%s = %s", node.Iden, propValueString(node))
+			w.writeTrailing(w.comments.trailing[node.B])
+			continue
+		case ConstNodeKind:
+			fmt.Fprintf(&w.sb, "const %s = %s;", node.Iden, literalString(*node.Literal))
+			w.writeTrailing(w.comments.trailing[node.B])
+			continue
 		case StructNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "message %s struct {\n", node.Iden)
-			WriteMemberList(sb, node.MemberKind(), node.Members, depth+1)
-			WriteNodeList(sb, node.LocalDefs, depth+1)
-			writeIndents(sb, depth)
-			sb.WriteString("}\n")
+			fmt.Fprintf(&w.sb, "message %s struct%s {", node.Iden, typeParamsString(node.TypeParams))
 		case UnionNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "message %s union {\n", node.Iden)
-			WriteMemberList(sb, node.MemberKind(), node.Members, depth+1)
-			WriteNodeList(sb, node.LocalDefs, depth+1)
-			writeIndents(sb, depth)
-			sb.WriteString("}\n")
+			fmt.Fprintf(&w.sb, "message %s %sunion%s {", node.Iden, sizeString(node), typeParamsString(node.TypeParams))
 		case EnumNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "message %s enum {\n", node.Iden)
-			WriteMemberList(sb, node.MemberKind(), node.Members, depth+1)
-			writeIndents(sb, depth)
-			sb.WriteString("}\n")
+			fmt.Fprintf(&w.sb, "message %s %senum {", node.Iden, sizeString(node))
 		case ServiceNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "service %s {\n", node.Iden)
-			WriteMemberList(sb, node.MemberKind(), node.Members, depth+1)
-			WriteNodeList(sb, node.LocalDefs, depth+1)
-			writeIndents(sb, depth)
-			sb.WriteString("}\n")
+			fmt.Fprintf(&w.sb, "service %s {", node.Iden)
+		}
+
+		opening := w.comments.opening[node.B]
+		closing := w.comments.closing[node.B]
+		if len(node.Members) > 0 || len(node.LocalDefs) > 0 || len(opening) > 0 || len(closing) > 0 {
+			w.writeTrailing(opening)
+			members := slices.Clone(node.Members)
+			sortMembers(members)
+			w.writeMemberList(node.MemberKind(), members, depth+1)
+			w.writeNodeList(node.LocalDefs, depth+1, len(members) > 0)
+			w.writeComments(closing, depth+1)
+			w.writeIndents(depth)
 		}
+		w.sb.WriteString("}")
+		w.writeTrailing(w.comments.trailing[node.B])
+	}
+}
+
+func sizeString(node DefNode) string {
+	if node.SizeConst != "" {
+		return "[" + node.SizeConst + "]"
 	}
+	if node.Size == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[%d]", node.Size)
+}
+
+func typeParamsString(params []string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// propValueString writes integers and constants as they are, and quotes any other value
+func propValueString(prop DefNode) string {
+	if prop.Literal != nil {
+		return prop.Literal.Value
+	}
+	if prop.Value != "" && strings.Trim(prop.Value, numeric) == "" {
+		return prop.Value
+	}
+	return quoteString(prop.Value)
+}
+
+// literalString writes a literal as it was written, quoting strings again
+func literalString(lit Literal) string {
+	if lit.Kind == TokString {
+		return quoteString(lit.Value)
+	}
+	return lit.Value
+}
+
+// writeProps writes the options of a member after its type
+func (w *astWriter) writeProps(props []DefNode) {
+	if len(props) == 0 {
+		return
+	}
+	w.sb.WriteString(" [")
+	for i, prop := range props {
+		if i > 0 {
+			w.sb.WriteString(", ")
+		}
+		fmt.Fprintf(&w.sb, "%s = %s", prop.Iden, propValueString(prop))
+	}
+	w.sb.WriteString("]")
+}
+
+// writeRpcList writes the parameters or results of an rpc, either a single type or a list of optionally named types
+func (w *astWriter) writeRpcList(typ TypeNode, list []MembNode, stream bool) {
+	if stream {
+		w.sb.WriteString("stream ")
+	}
+	if list == nil {
+		WriteType(&w.sb, typ)
+		return
+	}
+	for i, item := range list {
+		if i > 0 {
+			w.sb.WriteString(", ")
+		}
+		if item.Iden != "" {
+			w.sb.WriteString(item.Iden)
+			w.sb.WriteString(" ")
+		}
+		WriteType(&w.sb, item.LType)
+	}
+}
+
+// quoteString quotes a string with the escape sequences the parser accepts
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteString("\"")
+	for _, ch := range s {
+		switch ch {
+		case '\\', '"':
+			sb.WriteRune('\\')
+			sb.WriteRune(ch)
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case '\f':
+			sb.WriteString("\\f")
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	sb.WriteString("\"")
+	return sb.String()
 }
 
 func WriteType(sb *strings.Builder, node TypeNode) {
-	for _, size := range node.Array {
-		if size != 0 {
+	for i, size := range node.Array {
+		if i < len(node.Consts) && node.Consts[i] != "" {
+			fmt.Fprintf(sb, "[%s]", node.Consts[i])
+		} else if size != 0 {
 			fmt.Fprintf(sb, "[%d]", size)
 		} else {
 			sb.WriteString("[]")
@@ -101,29 +259,33 @@ func WriteType(sb *strings.Builder, node TypeNode) {
 	}
 }
 
-func WriteMemberList(sb *strings.Builder, kind NodeKind, nodes []MembNode, depth int) {
+func (w *astWriter) writeMemberList(kind NodeKind, nodes []MembNode, depth int) {
 	for _, node := range nodes {
+		w.writeComments(w.comments.leading[node.B], depth)
+		w.writeIndents(depth)
 		switch kind {
 		case FieldNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "%s %s @%d ", node.Modifier, node.Iden, node.Ord)
-			WriteType(sb, node.LType)
-			sb.WriteString(";\n")
+			fmt.Fprintf(&w.sb, "%s %s @%d ", node.Modifier, node.Iden, node.Ord)
+			WriteType(&w.sb, node.LType)
+			if node.Default != nil {
+				fmt.Fprintf(&w.sb, " = %s", literalString(*node.Default))
+			}
+			w.writeProps(node.Props)
+			w.sb.WriteString(";")
 		case CaseNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "@%d %s;\n", node.Ord, node.Iden)
+			fmt.Fprintf(&w.sb, "@%d %s;", node.Ord, node.Iden)
 		case OptionNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "%s @%d ", node.Iden, node.Ord)
-			WriteType(sb, node.LType)
-			sb.WriteString(";\n")
+			fmt.Fprintf(&w.sb, "%s @%d ", node.Iden, node.Ord)
+			WriteType(&w.sb, node.LType)
+			w.writeProps(node.Props)
+			w.sb.WriteString(";")
 		case RpcNodeKind:
-			writeIndents(sb, depth)
-			fmt.Fprintf(sb, "rpc @%d %s(", node.Ord, node.Iden)
-			WriteType(sb, node.LType)
-			sb.WriteString(") returns (")
-			WriteType(sb, node.RType)
-			sb.WriteString(");\n")
+			fmt.Fprintf(&w.sb, "rpc @%d %s(", node.Ord, node.Iden)
+			w.writeRpcList(node.LType, node.Params, node.LStream)
+			w.sb.WriteString(") returns (")
+			w.writeRpcList(node.RType, node.Results, node.RStream)
+			w.sb.WriteString(")")
 		}
+		w.writeTrailing(w.comments.trailing[node.B])
 	}
 }
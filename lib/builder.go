@@ -1,11 +1,29 @@
 package lib
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"math"
 	"math/big"
-	"strings"
+	"slices"
+	"strconv"
+	"unicode/utf8"
 )
 
+// LenBits is the number of bits used to prefix the byte length of a string
+const LenBits = 32
+
+// MaxLen bounds the length of a string written or read, or of a decoded array that does not declare its own limit, so a hostile length cannot exhaust memory
+const MaxLen = 1 << 24
+
+var ErrBitWidth = errors.New("bit width is out of range")
+var ErrUTF8 = errors.New("string is not valid utf-8")
+
+// BitState stores the byte currently being packed or unpacked
+// for a writer, off is the number of bits already filled in curr, for a reader it is the number of bits left to consume
 type BitState struct {
 	off  int
 	curr uint8
@@ -13,70 +31,425 @@ type BitState struct {
 
 type BitReader struct {
 	BitState
-	r io.Reader
+	r   io.Reader
+	buf [1]byte
 }
 
 type BitWriter struct {
 	BitState
-	w io.Writer
+	w   io.Writer
+	buf [1]byte
+
+	// Truncate skips range checks, writing the low bits of integers that do not fit in their width, for hot paths where values are known to fit
+	Truncate bool
 }
 
-func (r *BitReader) ReadInt64(n int) int64 {
-	var i int64
+func NewBitReader(r io.Reader) *BitReader {
+	return &BitReader{r: r}
+}
 
-	return i
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{w: w}
+}
+
+func (r *BitReader) readByte() error {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			// any read is in the middle of a value, so running out of bytes is always unexpected
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	r.curr = r.buf[0]
+	r.off = 8
+	return nil
+}
+
+// readBits reads the next n bits MSB-first into the low bits of a uint64, n must be at most 64
+func (r *BitReader) readBits(n int) (uint64, error) {
+	var u uint64
+	for n > 0 {
+		if r.off == 0 {
+			if err := r.readByte(); err != nil {
+				return 0, err
+			}
+		}
+		k := min(r.off, n)
+		u = u<<k | uint64(r.curr>>(r.off-k)&(1<<k-1))
+		r.off -= k
+		n -= k
+	}
+	return u, nil
+}
+
+func (w *BitWriter) writeByte() error {
+	w.buf[0] = w.curr
+	w.curr = 0
+	w.off = 0
+	_, err := w.w.Write(w.buf[:])
+	return err
+}
+
+// writeBits writes the low n bits of u MSB-first, n must be at most 64
+func (w *BitWriter) writeBits(u uint64, n int) error {
+	for n > 0 {
+		k := min(8-w.off, n)
+		w.curr |= (byte(u>>(n-k)) & (1<<k - 1)) << (8 - w.off - k)
+		w.off += k
+		n -= k
+		if w.off == 8 {
+			if err := w.writeByte(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Align discards the remaining bits of a partially consumed byte, the counterpart to Flush
+func (r *BitReader) Align() {
+	r.off = 0
+	r.curr = 0
+}
+
+// Flush writes out a partially filled byte, padding the low bits with zeros
+func (w *BitWriter) Flush() error {
+	if w.off == 0 {
+		return nil
+	}
+	return w.writeByte()
+}
+
+func validWidth(n int) bool {
+	return n > 0 && n <= 64
+}
+
+func (r *BitReader) ReadUint64(n int) (uint64, error) {
+	if !validWidth(n) {
+		return 0, ErrBitWidth
+	}
+	return r.readBits(n)
+}
+
+func (w *BitWriter) WriteUint64(u uint64, n int) error {
+	if err := w.checkUint64(u, n); err != nil {
+		return err
+	}
+	return w.writeBits(u, n)
+}
+
+func (w *BitWriter) checkUint64(u uint64, n int) error {
+	if !validWidth(n) {
+		return ErrBitWidth
+	}
+	if !w.Truncate && n < 64 && u >= 1<<n {
+		return &RangeErr{Bits: n, Value: strconv.FormatUint(u, 10)}
+	}
+	return nil
+}
+
+// ReadInt64 reads an n bit two's complement integer, sign extending it to 64 bits
+func (r *BitReader) ReadInt64(n int) (int64, error) {
+	if !validWidth(n) {
+		return 0, ErrBitWidth
+	}
+	u, err := r.readBits(n)
+	return signExtend(u, n), err
+}
+
+func signExtend(u uint64, n int) int64 {
+	shift := 64 - n
+	return int64(u<<shift) >> shift
+}
+
+// WriteInt64 writes the n bit two's complement representation of i
+func (w *BitWriter) WriteInt64(i int64, n int) error {
+	if err := w.checkInt64(i, n); err != nil {
+		return err
+	}
+	return w.writeBits(uint64(i), n)
 }
 
-func (w *BitWriter) WriteInt64(i int64, n int) {
+func (w *BitWriter) checkInt64(i int64, n int) error {
+	if !validWidth(n) {
+		return ErrBitWidth
+	}
+	if !w.Truncate && n < 64 && (i < -1<<(n-1) || i >= 1<<(n-1)) {
+		return &RangeErr{Bits: n, Value: strconv.FormatInt(i, 10)}
+	}
+	return nil
+}
+
+// ReadBigInt reads an n bit two's complement integer of any width
+func (r *BitReader) ReadBigInt(n int) (big.Int, error) {
+	return r.readBigInt(n, false)
+}
+
+func (r *BitReader) readBigInt(n int, le bool) (big.Int, error) {
+	i, err := r.readBigUint(n, le)
+	if err != nil {
+		return i, err
+	}
+	if i.Bit(n-1) == 1 {
+		i.Sub(&i, new(big.Int).Lsh(big.NewInt(1), uint(n)))
+	}
+	return i, nil
+}
 
+// ReadBigUint reads an n bit unsigned integer of any width
+func (r *BitReader) ReadBigUint(n int) (big.Int, error) {
+	return r.readBigUint(n, false)
 }
 
-func (r *BitReader) ReadBigInt(n int) big.Int {
+// readBigUint reads the bytes of an integer most significant first, or least significant first when le is set
+// the most significant byte contains only the leftover high bits when n is not a multiple of 8
+func (r *BitReader) readBigUint(n int, le bool) (big.Int, error) {
 	var i big.Int
+	if n <= 0 {
+		return i, ErrBitWidth
+	}
 
-	return i
+	bytes := make([]byte, (n+7)/8)
+	for j := range bytes {
+		idx := j
+		if le {
+			idx = len(bytes) - 1 - j
+		}
+		k := 8
+		if idx == 0 {
+			k = n - 8*(len(bytes)-1)
+		}
+		u, err := r.readBits(k)
+		if err != nil {
+			return i, err
+		}
+		bytes[idx] = byte(u)
+	}
+	i.SetBytes(bytes)
+	return i, nil
+}
+
+// WriteBigInt writes the n bit two's complement representation of i
+func (w *BitWriter) WriteBigInt(i big.Int, n int) error {
+	if err := w.checkBigInt(i, n); err != nil {
+		return err
+	}
+	return w.writeBigBits(i, n, false)
+}
+
+func (w *BitWriter) checkBigInt(i big.Int, n int) error {
+	if n <= 0 {
+		return ErrBitWidth
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(n-1))
+	if !w.Truncate && (i.Cmp(new(big.Int).Neg(limit)) < 0 || i.Cmp(limit) >= 0) {
+		return &RangeErr{Bits: n, Value: i.String()}
+	}
+	return nil
+}
+
+// WriteBigUint writes an n bit unsigned integer of any width
+func (w *BitWriter) WriteBigUint(i big.Int, n int) error {
+	if err := w.checkBigUint(i, n); err != nil {
+		return err
+	}
+	return w.writeBigBits(i, n, false)
+}
+
+func (w *BitWriter) checkBigUint(i big.Int, n int) error {
+	if n <= 0 {
+		return ErrBitWidth
+	}
+	if !w.Truncate && (i.Sign() < 0 || i.BitLen() > n) {
+		return &RangeErr{Bits: n, Value: i.String()}
+	}
+	return nil
+}
+
+// writeBigBits writes the low n bits of the two's complement representation of i, the counterpart to readBigUint
+func (w *BitWriter) writeBigBits(i big.Int, n int, le bool) error {
+	// big.Int.And treats negative numbers as if they were in infinite precision two's complement
+	mask := new(big.Int).Lsh(big.NewInt(1), uint(n))
+	mask.Sub(mask, big.NewInt(1))
+	v := new(big.Int).And(&i, mask)
+
+	bytes := v.FillBytes(make([]byte, (n+7)/8))
+	for j := range bytes {
+		idx := j
+		if le {
+			idx = len(bytes) - 1 - j
+		}
+		k := 8
+		if idx == 0 {
+			k = n - 8*(len(bytes)-1)
+		}
+		if err := w.writeBits(uint64(bytes[idx]), k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BitReader) ReadFloat32() (float32, error) {
+	u, err := r.readBits(32)
+	return math.Float32frombits(uint32(u)), err
 }
 
-func (w *BitWriter) WriteBigInt(i big.Int, n int) {
+func (w *BitWriter) WriteFloat32(f float32) error {
+	return w.writeBits(uint64(math.Float32bits(f)), 32)
+}
 
+func (r *BitReader) ReadFloat64() (float64, error) {
+	u, err := r.readBits(64)
+	return math.Float64frombits(u), err
 }
 
-func (r *BitReader) ReadFloat32() float32 {
-	var f float32
+func (w *BitWriter) WriteFloat64(f float64) error {
+	return w.writeBits(math.Float64bits(f), 64)
+}
 
-	return f
+// ReadString reads a string prefixed with its byte length in LenBits bits
+func (r *BitReader) ReadString() (string, error) {
+	return r.readString(r.readBits)
 }
 
-func (w *BitWriter) WriteFloat32(f float32) {
+// readString reads the length prefix with readLen, so the prefix may be in either byte order
+func (r *BitReader) readString(readLen func(n int) (uint64, error)) (string, error) {
+	size, err := readLen(LenBits)
+	if err != nil {
+		return "", err
+	}
+
+	if err := CheckLen(size, MaxLen); err != nil {
+		return "", err
+	}
 
+	// the bytes are read in chunks, so a length prefix longer than the input cannot allocate more than the input holds
+	var bytes []byte
+	for uint64(len(bytes)) < size {
+		start := len(bytes)
+		bytes = append(bytes, make([]byte, min(size-uint64(start), strChunk))...)
+		if err := r.readBytes(bytes[start:]); err != nil {
+			return "", err
+		}
+	}
+	return string(bytes), nil
 }
 
-func (r *BitReader) ReadFloat64() float64 {
-	var f float64
+// strChunk is the most bytes of a string allocated before they have been read
+const strChunk = 1 << 16
+
+func (r *BitReader) readBytes(bytes []byte) error {
+	if r.off == 0 {
+		// when aligned, we can read the bytes directly from the underlying reader
+		if _, err := io.ReadFull(r.r, bytes); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		return nil
+	}
+	for i := range bytes {
+		u, err := r.readBits(8)
+		if err != nil {
+			return err
+		}
+		bytes[i] = byte(u)
+	}
+	return nil
+}
 
-	return f
+// WriteString writes a string prefixed with its byte length in LenBits bits
+func (w *BitWriter) WriteString(s string) error {
+	return w.writeString(s, w.writeBits)
 }
 
-func (w *BitWriter) WriteFloat64(f float64) {
+func (w *BitWriter) writeString(s string, writeLen func(u uint64, n int) error) error {
+	// strings longer than MaxLen would encode, but could never be decoded
+	if err := CheckLen(uint64(len(s)), MaxLen); err != nil {
+		return err
+	}
+	if err := writeLen(uint64(len(s)), LenBits); err != nil {
+		return err
+	}
 
+	if w.off == 0 {
+		// when aligned, we can write the bytes directly to the underlying writer
+		_, err := io.WriteString(w.w, s)
+		return err
+	}
+	for i := 0; i < len(s); i++ {
+		if err := w.writeBits(uint64(s[i]), 8); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *BitReader) ReadString() string {
-	var sb strings.Builder
+func (r *BitReader) ReadBool() (bool, error) {
+	u, err := r.readBits(1)
+	return u == 1, err
+}
+
+func (w *BitWriter) WriteBool(b bool) error {
+	var u uint64
+	if b {
+		u = 1
+	}
+	return w.writeBits(u, 1)
+}
 
-	return sb.String()
+// CheckUTF8 returns ErrUTF8 if s is not valid utf-8, for schemas that encode strings as utf-8 rather than as raw bytes
+func CheckUTF8(s string) error {
+	if !utf8.ValidString(s) {
+		return ErrUTF8
+	}
+	return nil
 }
 
-func (w *BitWriter) WriteString(s string) {
+// SortedKeys returns the keys of a map in ascending order, so the same map is always encoded to the same bytes
+func SortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	return slices.Sorted(maps.Keys(m))
+}
 
+// SortedBoolKeys returns the keys of a map keyed by bool in ascending order, false before true
+func SortedBoolKeys[V any](m map[bool]V) []bool {
+	var keys []bool
+	for _, k := range []bool{false, true} {
+		if _, ok := m[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
 }
 
-func (r *BitReader) ReadBool() bool {
-	var b bool
+// CheckKeyOrder ensures a key of a decoded map is greater than the key before it, so each map has a single encoding
+func CheckKeyOrder[K cmp.Ordered](prev K, k K) error {
+	if cmp.Compare(k, prev) <= 0 {
+		return &KeyOrderErr{Key: fmt.Sprint(k)}
+	}
+	return nil
+}
 
-	return b
+// CheckBoolKeyOrder ensures a key of a decoded map keyed by bool is greater than the key before it, which can only be true after false
+func CheckBoolKeyOrder(prev bool, k bool) error {
+	if prev || !k {
+		return &KeyOrderErr{Key: strconv.FormatBool(k)}
+	}
+	return nil
 }
 
-func (w *BitWriter) WriteBool(b bool) {
+// Ptr returns a pointer to a copy of v, for the defaults of optional fields
+func Ptr[T any](v T) *T {
+	return &v
+}
 
+// BigInt parses the default of a big integer field, which the compiler has already checked is a decimal integer
+func BigInt(s string) big.Int {
+	var i big.Int
+	if _, ok := i.SetString(s, 10); !ok {
+		panic("assertion error: invalid big integer default: " + s)
+	}
+	return i
 }
@@ -1 +1,287 @@
 package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitWriter_Packing(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	assert.NoError(t, w.WriteUint64(0b101, 3))
+	assert.NoError(t, w.WriteInt64(-1, 7))
+	assert.NoError(t, w.WriteBool(true))
+	assert.NoError(t, w.WriteUint64(0xABC, 12))
+	assert.NoError(t, w.Flush())
+
+	// 101 1111111 1 101010111100 followed by a single padding bit
+	assert.Equal(t, []byte{0b10111111, 0b11110101, 0b01111000}, buf.Bytes())
+}
+
+func TestBitReader_Unpacking(t *testing.T) {
+	r := NewBitReader(bytes.NewReader([]byte{0b10111111, 0b11110101, 0b01111000}))
+
+	u, err := r.ReadUint64(3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0b101), u)
+
+	i, err := r.ReadInt64(7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), i)
+
+	b, err := r.ReadBool()
+	assert.NoError(t, err)
+	assert.True(t, b)
+
+	u, err = r.ReadUint64(12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xABC), u)
+
+	_, err = r.ReadUint64(8)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestBitWriter_RoundTrip(t *testing.T) {
+	big1, _ := new(big.Int).SetString("-170141183460469231731687303715884105728", 10)
+	big2, _ := new(big.Int).SetString("1267650600228229401496703205375", 10)
+
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	assert.NoError(t, w.WriteBool(false))
+	assert.NoError(t, w.WriteInt64(-5, 4))
+	assert.NoError(t, w.WriteInt64(-9223372036854775808, 64))
+	assert.NoError(t, w.WriteBigInt(*big1, 128))
+	assert.NoError(t, w.WriteBigInt(*big2, 101))
+	assert.NoError(t, w.WriteString("hello, world"))
+	assert.NoError(t, w.WriteFloat32(3.25))
+	assert.NoError(t, w.WriteFloat64(-1.0e100))
+	assert.NoError(t, w.WriteUint64(1, 1))
+	assert.NoError(t, w.WriteString(""))
+	assert.NoError(t, w.Flush())
+
+	r := NewBitReader(&buf)
+
+	b, err := r.ReadBool()
+	assert.NoError(t, err)
+	assert.False(t, b)
+
+	i, err := r.ReadInt64(4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-5), i)
+
+	i, err = r.ReadInt64(64)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-9223372036854775808), i)
+
+	bi, err := r.ReadBigInt(128)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big1.Cmp(&bi))
+
+	bi, err = r.ReadBigInt(101)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big2.Cmp(&bi))
+
+	s, err := r.ReadString()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world", s)
+
+	f32, err := r.ReadFloat32()
+	assert.NoError(t, err)
+	assert.Equal(t, float32(3.25), f32)
+
+	f64, err := r.ReadFloat64()
+	assert.NoError(t, err)
+	assert.Equal(t, -1.0e100, f64)
+
+	u, err := r.ReadUint64(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), u)
+
+	s, err = r.ReadString()
+	assert.NoError(t, err)
+	assert.Equal(t, "", s)
+}
+
+func TestBitWriter_Widths(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	r := NewBitReader(&buf)
+
+	assert.ErrorIs(t, w.WriteInt64(1, 0), ErrBitWidth)
+	assert.ErrorIs(t, w.WriteUint64(1, 65), ErrBitWidth)
+	assert.ErrorIs(t, w.WriteBigInt(*big.NewInt(1), 0), ErrBitWidth)
+
+	_, err := r.ReadInt64(65)
+	assert.ErrorIs(t, err, ErrBitWidth)
+	_, err = r.ReadBigInt(-1)
+	assert.ErrorIs(t, err, ErrBitWidth)
+}
+
+func TestBitReader_BigUint(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	// the same bits are read back as a negative signed integer, but a large unsigned integer
+	max := new(big.Int).Lsh(big.NewInt(1), 100)
+	max.Sub(max, big.NewInt(1))
+	assert.NoError(t, w.WriteBigUint(*max, 100))
+	assert.NoError(t, w.WriteBigUint(*max, 100))
+	assert.NoError(t, w.Flush())
+
+	r := NewBitReader(&buf)
+	bi, err := r.ReadBigUint(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, max.Cmp(&bi))
+
+	bi, err = r.ReadBigInt(100)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), bi.Int64())
+
+	_, err = r.ReadBigUint(0)
+	assert.ErrorIs(t, err, ErrBitWidth)
+}
+
+func TestBitWriter_Range(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	assert.NoError(t, w.WriteInt64(-16, 5))
+	assert.NoError(t, w.WriteInt64(15, 5))
+	assert.Equal(t, &RangeErr{Bits: 5, Value: "16"}, w.WriteInt64(16, 5))
+	assert.Equal(t, &RangeErr{Bits: 5, Value: "-17"}, w.WriteInt64(-17, 5))
+	assert.NoError(t, w.WriteUint64(31, 5))
+	assert.Equal(t, &RangeErr{Bits: 5, Value: "32"}, w.WriteUint64(32, 5))
+
+	limit := new(big.Int).Lsh(big.NewInt(1), 99)
+	assert.Equal(t, &RangeErr{Bits: 100, Value: limit.String()}, w.WriteBigInt(*limit, 100))
+	assert.NoError(t, w.WriteBigUint(*limit, 100))
+	assert.Equal(t, &RangeErr{Bits: 100, Value: "-1"}, w.WriteBigUint(*big.NewInt(-1), 100))
+
+	// the path of the field is built up as the error is returned through each message
+	err := InField(InField(w.WriteUint64(4, 2), "row"), "move")
+	assert.EqualError(t, err, "move.row: 4 does not fit in 2 bits")
+	assert.Equal(t, assert.AnError, InField(assert.AnError, "row"))
+}
+
+func TestCheckLen(t *testing.T) {
+	assert.NoError(t, CheckLen(64, 64))
+	assert.Equal(t, &LenErr{Len: 65, Max: 64}, CheckLen(65, 64))
+
+	err := InField(InField(CheckLen(MaxLen+1, MaxLen), "cells"), "board")
+	assert.EqualError(t, err, fmt.Sprintf("board.cells: length %d exceeds the maximum of %d", MaxLen+1, MaxLen))
+}
+
+func TestCheckUTF8(t *testing.T) {
+	assert.NoError(t, CheckUTF8("héllo"))
+	assert.ErrorIs(t, CheckUTF8("\xff"), ErrUTF8)
+}
+
+func TestBitWriter_Truncate(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	w.Truncate = true
+
+	assert.NoError(t, w.WriteInt64(17, 5))
+	assert.NoError(t, w.WriteUint64(0xFF, 3))
+	assert.NoError(t, w.Flush())
+
+	r := NewBitReader(&buf)
+	i, err := r.ReadInt64(5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-15), i)
+	u, err := r.ReadUint64(3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), u)
+}
+
+func TestBitReader_Align(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	assert.NoError(t, w.WriteUint64(0b11, 2))
+	assert.NoError(t, w.Flush())
+	assert.NoError(t, w.WriteUint64(0xFF, 8))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, []byte{0b11000000, 0xFF}, buf.Bytes())
+
+	r := NewBitReader(&buf)
+	u, err := r.ReadUint64(2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0b11), u)
+
+	r.Align()
+	u, err = r.ReadUint64(8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xFF), u)
+}
+
+func TestSortedKeys(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, SortedKeys(map[string]int{"c": 3, "a": 1, "b": 2}))
+	assert.Equal(t, []int8{-2, 0, 5}, SortedKeys(map[int8]bool{5: true, -2: false, 0: true}))
+	assert.Empty(t, SortedKeys(map[uint8]int{}))
+
+	assert.Equal(t, []bool{false, true}, SortedBoolKeys(map[bool]int{true: 1, false: 0}))
+	assert.Equal(t, []bool{true}, SortedBoolKeys(map[bool]int{true: 1}))
+}
+
+func TestCheckKeyOrder(t *testing.T) {
+	assert.NoError(t, CheckKeyOrder("a", "b"))
+	assert.Equal(t, &KeyOrderErr{Key: "a"}, CheckKeyOrder("a", "a"))
+	assert.Equal(t, &KeyOrderErr{Key: "-3"}, CheckKeyOrder[int8](5, -3))
+
+	assert.NoError(t, CheckBoolKeyOrder(false, true))
+	assert.Equal(t, &KeyOrderErr{Key: "false"}, CheckBoolKeyOrder(true, false))
+	assert.Equal(t, &KeyOrderErr{Key: "true"}, CheckBoolKeyOrder(true, true))
+}
+
+func TestDefaults(t *testing.T) {
+	p := Ptr[int16](-5)
+	assert.Equal(t, int16(-5), *p)
+	assert.NotSame(t, p, Ptr[int16](-5))
+
+	i := BigInt("-170141183460469231731687303715884105728")
+	assert.Equal(t, "-170141183460469231731687303715884105728", i.String())
+	assert.Panics(t, func() { BigInt("1.5") })
+}
+
+func TestBitReader_StringLen(t *testing.T) {
+	// a length prefix longer than the input fails once the input runs out, without allocating the length up front
+	r := NewBitReader(bytes.NewReader([]byte{0x00, 0xFF, 0xFF, 0xFF, 'a'}))
+	_, err := r.ReadString()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	r = NewBitReader(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF}))
+	_, err = r.ReadString()
+	assert.Equal(t, &LenErr{Len: 1<<32 - 1, Max: MaxLen}, err)
+
+	// a string just over the limit is refused both ways, so none is written that cannot be read
+	over := strings.Repeat("a", MaxLen+1)
+	assert.Equal(t, &LenErr{Len: MaxLen + 1, Max: MaxLen}, NewBitWriter(io.Discard).WriteString(over))
+	assert.Equal(t, &LenErr{Len: MaxLen + 1, Max: MaxLen}, NewBitWriter(io.Discard).WriteStringLE(over))
+	r = NewBitReader(strings.NewReader("\x01\x00\x00\x01" + over))
+	_, err = r.ReadString()
+	assert.Equal(t, &LenErr{Len: MaxLen + 1, Max: MaxLen}, err)
+
+	// strings longer than a chunk are read whole, aligned or not
+	long := strings.Repeat("abc", strChunk)
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	assert.NoError(t, w.WriteBool(true))
+	assert.NoError(t, w.WriteString(long))
+	assert.NoError(t, w.Flush())
+
+	r = NewBitReader(&buf)
+	_, err = r.ReadBool()
+	assert.NoError(t, err)
+	s, err := r.ReadString()
+	assert.NoError(t, err)
+	assert.Equal(t, long, s)
+}
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OrdErr is returned when an encoded or decoded ord does not belong to any case of an enum, or a decoded ord to any option of a union
+type OrdErr struct {
+	Type string
+	Ord  uint64
+}
+
+func (err *OrdErr) Error() string {
+	return fmt.Sprintf("%s: unknown ord '@%d'", err.Type, err.Ord)
+}
+
+// UnionErr is returned when encoding a union whose kind does not match the single non-nil option
+type UnionErr struct {
+	Type string
+	Kind int
+}
+
+func (err *UnionErr) Error() string {
+	return fmt.Sprintf("%s: kind %d does not match the set option", err.Type, err.Kind)
+}
+
+// CaseErr is returned when parsing a name that does not belong to any case of an enum
+type CaseErr struct {
+	Type string
+	Name string
+}
+
+func (err *CaseErr) Error() string {
+	return fmt.Sprintf("%s: unknown case \"%s\"", err.Type, err.Name)
+}
+
+// RangeErr is returned when encoding an integer that does not fit in the width it is declared with
+type RangeErr struct {
+	Field string // the path to the field from the message being encoded, such as "board.cells", empty when not encoding a message
+	Bits  int
+	Value string // the value in decimal, as it may be wider than 64 bits
+}
+
+func (err *RangeErr) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("%s does not fit in %d bits", err.Value, err.Bits)
+	}
+	return fmt.Sprintf("%s: %s does not fit in %d bits", err.Field, err.Value, err.Bits)
+}
+
+// LenErr is returned when an array is longer than the maximum length it is declared with
+type LenErr struct {
+	Field string // the path to the field from the message being encoded, empty when decoding
+	Len   uint64
+	Max   uint64
+}
+
+func (err *LenErr) Error() string {
+	if err.Field == "" {
+		return fmt.Sprintf("length %d exceeds the maximum of %d", err.Len, err.Max)
+	}
+	return fmt.Sprintf("%s: length %d exceeds the maximum of %d", err.Field, err.Len, err.Max)
+}
+
+// CheckLen returns a LenErr if n exceeds max
+func CheckLen(n uint64, max uint64) error {
+	if n > max {
+		return &LenErr{Len: n, Max: max}
+	}
+	return nil
+}
+
+func prefixField(field string, path string) string {
+	if path == "" {
+		return field
+	}
+	return field + "." + path
+}
+
+// InField prefixes the path of a range or length error with the field it was returned while encoding, other errors are returned unchanged
+func InField(err error, field string) error {
+	var rangeErr *RangeErr
+	if errors.As(err, &rangeErr) {
+		rangeErr.Field = prefixField(field, rangeErr.Field)
+	}
+	var lenErr *LenErr
+	if errors.As(err, &lenErr) {
+		lenErr.Field = prefixField(field, lenErr.Field)
+	}
+	return err
+}
+
+// KeyOrderErr is returned when decoding a map whose keys are not in strictly ascending order, as no map is encoded that way
+type KeyOrderErr struct {
+	Key string // the key out of order, formatted with %v
+}
+
+func (err *KeyOrderErr) Error() string {
+	return fmt.Sprintf("map key %s is not greater than the key before it", err.Key)
+}
+
+// RemoteErr is returned by a client when the server failed to handle a request
+type RemoteErr struct {
+	Msg string
+}
+
+func (err *RemoteErr) Error() string {
+	return fmt.Sprintf("remote: %s", err.Msg)
+}
@@ -1 +1,530 @@
 package lib
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// the header of a frame is bit-packed, then padded to a byte boundary before the payload
+const (
+	KindBits    = 4
+	ServiceBits = 32
+	OrdBits     = 16
+	ReqIdBits   = 32
+	PayloadBits = 32
+)
+
+// MaxPayload bounds the payload a peer may send in a single frame, so a hostile length cannot exhaust memory
+const MaxPayload = 1 << 24
+
+var ErrPayloadSize = errors.New("frame payload exceeds the maximum size")
+var ErrFrameOrd = errors.New("rpc ord does not fit in a frame")
+var ErrClosed = errors.New("connection is closed")
+var ErrSendClosed = errors.New("stream is closed for sending")
+var ErrNilResponse = errors.New("handler returned a nil response")
+
+type FrameKind uint8
+
+const (
+	NoFrameKind FrameKind = iota
+	RequestFrameKind
+	ResponseFrameKind
+	ErrorFrameKind
+	OpenFrameKind    // starts a streaming rpc, every later frame of the stream carries the same request id
+	MessageFrameKind // carries one message of a stream, in either direction
+	EndFrameKind     // ends a stream in the direction it is sent, from the server it ends the whole call
+	CancelFrameKind  // abandons a stream, sent by the client
+)
+
+func (kind FrameKind) String() string {
+	switch kind {
+	case NoFrameKind:
+		return "unknown"
+	case RequestFrameKind:
+		return "request"
+	case ResponseFrameKind:
+		return "response"
+	case ErrorFrameKind:
+		return "error"
+	case OpenFrameKind:
+		return "open"
+	case MessageFrameKind:
+		return "message"
+	case EndFrameKind:
+		return "end"
+	case CancelFrameKind:
+		return "cancel"
+	default:
+		return fmt.Sprintf("FrameKind(%d)", uint8(kind))
+	}
+}
+
+type Frame struct {
+	Kind    FrameKind
+	Service uint32
+	Ord     uint64
+	ReqId   uint32
+	Payload []byte
+}
+
+func WriteFrame(w io.Writer, f Frame) error {
+	if f.Ord >= 1<<OrdBits {
+		return ErrFrameOrd
+	}
+	if len(f.Payload) > MaxPayload {
+		return ErrPayloadSize
+	}
+
+	bw := NewBitWriter(w)
+	if err := bw.WriteUint64(uint64(f.Kind), KindBits); err != nil {
+		return err
+	}
+	if err := bw.WriteUint64(uint64(f.Service), ServiceBits); err != nil {
+		return err
+	}
+	if err := bw.WriteUint64(f.Ord, OrdBits); err != nil {
+		return err
+	}
+	if err := bw.WriteUint64(uint64(f.ReqId), ReqIdBits); err != nil {
+		return err
+	}
+	if err := bw.WriteUint64(uint64(len(f.Payload)), PayloadBits); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(f.Payload)
+	return err
+}
+
+func ReadFrame(r io.Reader) (Frame, error) {
+	var f Frame
+	br := NewBitReader(r)
+
+	kind, err := br.ReadUint64(KindBits)
+	if err != nil {
+		return f, err
+	}
+	f.Kind = FrameKind(kind)
+
+	svc, err := br.ReadUint64(ServiceBits)
+	if err != nil {
+		return f, err
+	}
+	f.Service = uint32(svc)
+
+	if f.Ord, err = br.ReadUint64(OrdBits); err != nil {
+		return f, err
+	}
+
+	reqId, err := br.ReadUint64(ReqIdBits)
+	if err != nil {
+		return f, err
+	}
+	f.ReqId = uint32(reqId)
+
+	size, err := br.ReadUint64(PayloadBits)
+	if err != nil {
+		return f, err
+	}
+	if size > MaxPayload {
+		return f, ErrPayloadSize
+	}
+	br.Align()
+
+	f.Payload = make([]byte, size)
+	_, err = io.ReadFull(r, f.Payload)
+	return f, err
+}
+
+// encodeMessage packs a message into a byte aligned payload
+func encodeMessage(m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	if err := m.MarshalBits(w); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeErr(err error) []byte {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	// writing to a buffer cannot fail, and an error message will never exceed the string length prefix
+	_ = w.WriteString(err.Error())
+	return buf.Bytes()
+}
+
+func decodeErr(payload []byte) error {
+	msg, err := NewBitReader(bytes.NewReader(payload)).ReadString()
+	if err != nil {
+		return err
+	}
+	return &RemoteErr{Msg: msg}
+}
+
+// conn serializes frames written to a connection from many goroutines
+type conn struct {
+	net.Conn
+	mu sync.Mutex
+	w  *bufio.Writer
+	r  *bufio.Reader
+}
+
+func makeConn(c net.Conn) *conn {
+	return &conn{Conn: c, w: bufio.NewWriter(c), r: bufio.NewReader(c)}
+}
+
+func (c *conn) writeFrame(f Frame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := WriteFrame(c.w, f); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *conn) readFrame() (Frame, error) {
+	return ReadFrame(c.r)
+}
+
+// Server dispatches requests to the handler registered for their service id, each request is handled concurrently
+type Server struct {
+	mu        sync.Mutex
+	handlers  map[uint32]Handler
+	listeners map[net.Listener]bool
+	conns     map[*conn]bool
+	closed    bool
+}
+
+func NewServer() *Server {
+	return &Server{
+		handlers:  make(map[uint32]Handler),
+		listeners: make(map[net.Listener]bool),
+		conns:     make(map[*conn]bool),
+	}
+}
+
+func (s *Server) Register(svc uint32, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[svc] = h
+}
+
+func (s *Server) handler(svc uint32) Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers[svc]
+}
+
+// Serve accepts connections until the listener fails or the server is closed, in which case ErrClosed is returned
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+
+		sc := makeConn(c)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return ErrClosed
+		}
+		s.conns[sc] = true
+		s.mu.Unlock()
+
+		go s.serveConn(sc)
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		c.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+	}()
+
+	// the open streams of the connection by request id
+	var mu sync.Mutex
+	streams := make(map[uint32]*serverStream)
+
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch f.Kind {
+		case RequestFrameKind:
+			go s.serveRequest(ctx, c, f)
+		case OpenFrameKind:
+			st := newServerStream(ctx, c, f)
+			mu.Lock()
+			streams[f.ReqId] = st
+			mu.Unlock()
+			go func() {
+				s.serveStream(st)
+				mu.Lock()
+				delete(streams, f.ReqId)
+				mu.Unlock()
+			}()
+		case MessageFrameKind, EndFrameKind, CancelFrameKind:
+			mu.Lock()
+			st := streams[f.ReqId]
+			mu.Unlock()
+			if st == nil {
+				// the stream has already ended on this side, so the frame is stale
+				continue
+			}
+			if f.Kind == CancelFrameKind {
+				st.cancel(nil)
+			} else {
+				st.receive(f)
+			}
+		default:
+			// a client never sends anything else, so the connection cannot be trusted
+			return
+		}
+	}
+}
+
+func (s *Server) serveRequest(ctx context.Context, c *conn, f Frame) {
+	resp := Frame{Kind: ResponseFrameKind, Service: f.Service, Ord: f.Ord, ReqId: f.ReqId}
+
+	payload, err := s.handle(ctx, f)
+	if err != nil {
+		resp.Kind = ErrorFrameKind
+		payload = encodeErr(err)
+	}
+	resp.Payload = payload
+
+	// a failed write means the connection is broken, which the read loop will observe
+	_ = c.writeFrame(resp)
+}
+
+// recoverHandler turns a panic in a handler into the error the client is sent, so one bad handler or message does not take down the server
+func recoverHandler(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("handler panicked: %v", r)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, f Frame) (payload []byte, err error) {
+	defer recoverHandler(&err)
+	h := s.handler(f.Service)
+	if h == nil {
+		return nil, fmt.Errorf("unknown service: %#x", f.Service)
+	}
+	m, err := h.Handle(ctx, f.Ord, NewBitReader(bytes.NewReader(f.Payload)))
+	if err != nil {
+		return nil, err
+	}
+	return encodeMessage(m)
+}
+
+func (s *Server) serveStream(st *serverStream) {
+	defer st.cancel(nil)
+	if err := s.handleStream(st); err != nil {
+		// a failed write means the connection is broken, which the read loop will observe
+		_ = st.c.writeFrame(st.frame(ErrorFrameKind, encodeErr(err)))
+		return
+	}
+	_ = st.CloseSend()
+}
+
+func (s *Server) handleStream(st *serverStream) (err error) {
+	defer recoverHandler(&err)
+	h := s.handler(st.head.Service)
+	if h == nil {
+		return fmt.Errorf("unknown service: %#x", st.head.Service)
+	}
+	sh, ok := h.(StreamHandler)
+	if !ok {
+		return fmt.Errorf("service does not stream: %#x", st.head.Service)
+	}
+	return sh.HandleStream(st.ctx, st.head.Ord, st)
+}
+
+// Close stops all listeners and closes every open connection
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+
+	var errs []error
+	for l := range s.listeners {
+		errs = append(errs, l.Close())
+	}
+	for c := range s.conns {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Client multiplexes requests over a single connection, matching responses to requests by their id
+type Client struct {
+	c       *conn
+	mu      sync.Mutex
+	nextId  uint32
+	pending map[uint32]chan Frame
+	streams map[uint32]*clientStream
+	err     error
+	done    chan struct{}
+}
+
+var _ Invoker = (*Client)(nil)
+
+func Dial(network string, addr string) (*Client, error) {
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(c), nil
+}
+
+func NewClient(c net.Conn) *Client {
+	client := &Client{
+		c:       makeConn(c),
+		pending: make(map[uint32]chan Frame),
+		streams: make(map[uint32]*clientStream),
+		done:    make(chan struct{}),
+	}
+	go client.readLoop()
+	return client
+}
+
+func (c *Client) readLoop() {
+	var err error
+	for {
+		var f Frame
+		f, err = c.c.readFrame()
+		if err != nil {
+			break
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[f.ReqId]
+		delete(c.pending, f.ReqId)
+		st := c.streams[f.ReqId]
+		if f.Kind != MessageFrameKind {
+			// anything but a message from the server ends the stream
+			delete(c.streams, f.ReqId)
+		}
+		c.mu.Unlock()
+
+		if ok {
+			// each channel is buffered for the single response it will receive
+			ch <- f
+		} else if st != nil {
+			st.receive(f)
+		}
+	}
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+func (c *Client) register() (uint32, chan Frame, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+	c.nextId++
+	ch := make(chan Frame, 1)
+	c.pending[c.nextId] = ch
+	return c.nextId, ch, nil
+}
+
+func (c *Client) unregister(reqId uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, reqId)
+}
+
+func (c *Client) Invoke(ctx context.Context, svc uint32, ord uint64, req Message, resp Message) error {
+	payload, err := encodeMessage(req)
+	if err != nil {
+		return err
+	}
+
+	reqId, ch, err := c.register()
+	if err != nil {
+		return err
+	}
+
+	f := Frame{Kind: RequestFrameKind, Service: svc, Ord: ord, ReqId: reqId, Payload: payload}
+	if err := c.c.writeFrame(f); err != nil {
+		c.unregister(reqId)
+		return err
+	}
+
+	select {
+	case f := <-ch:
+		return receive(f, resp)
+	case <-ctx.Done():
+		c.unregister(reqId)
+		return ctx.Err()
+	case <-c.done:
+		// the response may have arrived just before the connection failed
+		select {
+		case f := <-ch:
+			return receive(f, resp)
+		default:
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	}
+}
+
+func receive(f Frame, resp Message) error {
+	if f.Kind == ErrorFrameKind {
+		return decodeErr(f.Payload)
+	}
+	return resp.UnmarshalBits(NewBitReader(bytes.NewReader(f.Payload)))
+}
+
+// Close closes the connection, failing any requests waiting for a response with ErrClosed
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = ErrClosed
+	}
+	c.mu.Unlock()
+	return c.c.Close()
+}
@@ -0,0 +1,171 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testMsg struct {
+	n int64
+}
+
+func (m *testMsg) MarshalBits(w *BitWriter) error {
+	return w.WriteInt64(m.n, 20)
+}
+
+func (m *testMsg) UnmarshalBits(r *BitReader) error {
+	n, err := r.ReadInt64(20)
+	m.n = n
+	return err
+}
+
+const testSvc = 0xCAFE
+
+type testHandler struct{}
+
+func (testHandler) Handle(ctx context.Context, ord uint64, r *BitReader) (Message, error) {
+	req := new(testMsg)
+	if err := req.UnmarshalBits(r); err != nil {
+		return nil, err
+	}
+	switch ord {
+	case 1:
+		return &testMsg{n: req.n * 2}, nil
+	case 2:
+		// echo the request after sleeping for the requested number of milliseconds
+		time.Sleep(time.Duration(req.n) * time.Millisecond)
+		return req, nil
+	case 4:
+		panic("bad request")
+	}
+	return nil, &OrdErr{Type: "Test", Ord: ord}
+}
+
+func runTestServer(t *testing.T) (*Server, *Client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer()
+	server.Register(testSvc, testHandler{})
+	go func() { _ = server.Serve(l) }()
+
+	client, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return server, client
+}
+
+func TestFrame_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	frame := Frame{Kind: RequestFrameKind, Service: 0xDEADBEEF, Ord: 513, ReqId: 7, Payload: []byte{1, 2, 3}}
+
+	assert.NoError(t, WriteFrame(&buf, frame))
+	// 116 bits of header are padded to 15 bytes
+	assert.Equal(t, 15+3, buf.Len())
+
+	actual, err := ReadFrame(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, frame, actual)
+
+	assert.ErrorIs(t, WriteFrame(&buf, Frame{Ord: 1 << OrdBits}), ErrFrameOrd)
+}
+
+func TestFrame_PayloadSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	assert.NoError(t, w.WriteUint64(uint64(ResponseFrameKind), KindBits))
+	assert.NoError(t, w.WriteUint64(0, ServiceBits+OrdBits))
+	assert.NoError(t, w.WriteUint64(0, ReqIdBits))
+	assert.NoError(t, w.WriteUint64(MaxPayload+1, PayloadBits))
+	assert.NoError(t, w.Flush())
+
+	_, err := ReadFrame(&buf)
+	assert.ErrorIs(t, err, ErrPayloadSize)
+}
+
+func TestNet_Invoke(t *testing.T) {
+	_, client := runTestServer(t)
+
+	var resp testMsg
+	err := client.Invoke(context.Background(), testSvc, 1, &testMsg{n: -21}, &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), resp.n)
+}
+
+func TestNet_Multiplex(t *testing.T) {
+	_, client := runTestServer(t)
+
+	// later requests finish first, so responses arrive out of order on the connection
+	var wg sync.WaitGroup
+	results := make([]int64, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var resp testMsg
+			err := client.Invoke(context.Background(), testSvc, 2, &testMsg{n: int64(50 - 5*i)}, &resp)
+			assert.NoError(t, err)
+			results[i] = resp.n
+		}()
+	}
+	wg.Wait()
+
+	for i, n := range results {
+		assert.Equal(t, int64(50-5*i), n)
+	}
+}
+
+func TestNet_Errors(t *testing.T) {
+	_, client := runTestServer(t)
+	ctx := context.Background()
+
+	var resp testMsg
+	err := client.Invoke(ctx, testSvc, 3, &testMsg{}, &resp)
+	assert.Equal(t, &RemoteErr{Msg: "Test: unknown ord '@3'"}, err)
+
+	err = client.Invoke(ctx, 0xBAD, 1, &testMsg{}, &resp)
+	assert.Equal(t, &RemoteErr{Msg: "unknown service: 0xbad"}, err)
+
+	// a panicking handler fails only its own request
+	err = client.Invoke(ctx, testSvc, 4, &testMsg{}, &resp)
+	assert.Equal(t, &RemoteErr{Msg: "handler panicked: bad request"}, err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = client.Invoke(timeoutCtx, testSvc, 2, &testMsg{n: 500}, &resp)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the connection is still usable after a request is abandoned
+	err = client.Invoke(ctx, testSvc, 1, &testMsg{n: 4}, &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), resp.n)
+
+	assert.NoError(t, client.Close())
+	err = client.Invoke(ctx, testSvc, 1, &testMsg{n: 4}, &resp)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestNet_ServerClose(t *testing.T) {
+	server, client := runTestServer(t)
+
+	var resp testMsg
+	assert.NoError(t, client.Invoke(context.Background(), testSvc, 1, &testMsg{n: 1}, &resp))
+
+	server.Close()
+	err := client.Invoke(context.Background(), testSvc, 1, &testMsg{n: 1}, &resp)
+	assert.Error(t, err)
+}
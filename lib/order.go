@@ -0,0 +1,116 @@
+package lib
+
+import (
+	"math"
+	"math/big"
+)
+
+// the LE variants write values wider than a byte least significant byte first, for schemas that set byteOrder = "little"
+// each byte is still packed MSB-first, and the most significant byte holds only the leftover high bits when the width is not a multiple of 8
+
+// readBitsLE reads n bits least significant byte first, n must be at most 64
+func (r *BitReader) readBitsLE(n int) (uint64, error) {
+	var u uint64
+	for shift := 0; n > 0; shift += 8 {
+		k := min(n, 8)
+		b, err := r.readBits(k)
+		if err != nil {
+			return 0, err
+		}
+		u |= b << shift
+		n -= k
+	}
+	return u, nil
+}
+
+// writeBitsLE writes the low n bits of u least significant byte first, n must be at most 64
+func (w *BitWriter) writeBitsLE(u uint64, n int) error {
+	for n > 0 {
+		k := min(n, 8)
+		if err := w.writeBits(u&0xFF, k); err != nil {
+			return err
+		}
+		u >>= 8
+		n -= k
+	}
+	return nil
+}
+
+func (r *BitReader) ReadUint64LE(n int) (uint64, error) {
+	if !validWidth(n) {
+		return 0, ErrBitWidth
+	}
+	return r.readBitsLE(n)
+}
+
+func (w *BitWriter) WriteUint64LE(u uint64, n int) error {
+	if err := w.checkUint64(u, n); err != nil {
+		return err
+	}
+	return w.writeBitsLE(u, n)
+}
+
+func (r *BitReader) ReadInt64LE(n int) (int64, error) {
+	if !validWidth(n) {
+		return 0, ErrBitWidth
+	}
+	u, err := r.readBitsLE(n)
+	return signExtend(u, n), err
+}
+
+func (w *BitWriter) WriteInt64LE(i int64, n int) error {
+	if err := w.checkInt64(i, n); err != nil {
+		return err
+	}
+	return w.writeBitsLE(uint64(i), n)
+}
+
+func (r *BitReader) ReadBigIntLE(n int) (big.Int, error) {
+	return r.readBigInt(n, true)
+}
+
+func (r *BitReader) ReadBigUintLE(n int) (big.Int, error) {
+	return r.readBigUint(n, true)
+}
+
+func (w *BitWriter) WriteBigIntLE(i big.Int, n int) error {
+	if err := w.checkBigInt(i, n); err != nil {
+		return err
+	}
+	return w.writeBigBits(i, n, true)
+}
+
+func (w *BitWriter) WriteBigUintLE(i big.Int, n int) error {
+	if err := w.checkBigUint(i, n); err != nil {
+		return err
+	}
+	return w.writeBigBits(i, n, true)
+}
+
+func (r *BitReader) ReadFloat32LE() (float32, error) {
+	u, err := r.readBitsLE(32)
+	return math.Float32frombits(uint32(u)), err
+}
+
+func (w *BitWriter) WriteFloat32LE(f float32) error {
+	return w.writeBitsLE(uint64(math.Float32bits(f)), 32)
+}
+
+func (r *BitReader) ReadFloat64LE() (float64, error) {
+	u, err := r.readBitsLE(64)
+	return math.Float64frombits(u), err
+}
+
+func (w *BitWriter) WriteFloat64LE(f float64) error {
+	return w.writeBitsLE(math.Float64bits(f), 64)
+}
+
+// ReadStringLE reads a string whose length prefix is least significant byte first
+func (r *BitReader) ReadStringLE() (string, error) {
+	return r.readString(r.readBitsLE)
+}
+
+// WriteStringLE writes a string whose length prefix is least significant byte first
+func (w *BitWriter) WriteStringLE(s string) error {
+	return w.writeString(s, w.writeBitsLE)
+}
@@ -0,0 +1,69 @@
+package lib
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitWriter_LittleEndian(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	// the low byte comes first, and the leftover high bits of a width that is not a multiple of 8 come last
+	assert.NoError(t, w.WriteUint64LE(0x1234, 16))
+	assert.NoError(t, w.WriteUint64LE(0xABC, 12))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, []byte{0x34, 0x12, 0xBC, 0xA0}, buf.Bytes())
+
+	r := NewBitReader(&buf)
+	u, err := r.ReadUint64LE(16)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x1234), u)
+	u, err = r.ReadUint64LE(12)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xABC), u)
+
+	assert.Equal(t, &RangeErr{Bits: 12, Value: "4096"}, w.WriteUint64LE(4096, 12))
+}
+
+func TestBitWriter_LittleEndianRoundTrip(t *testing.T) {
+	wide, _ := new(big.Int).SetString("-633825300114114700748351602688", 10)
+
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+
+	assert.NoError(t, w.WriteBool(true))
+	assert.NoError(t, w.WriteInt64LE(-300, 11))
+	assert.NoError(t, w.WriteBigIntLE(*wide, 100))
+	assert.NoError(t, w.WriteBigUintLE(*big.NewInt(0x123456), 70))
+	assert.NoError(t, w.WriteFloat32LE(3.25))
+	assert.NoError(t, w.WriteFloat64LE(-1.0e100))
+	assert.NoError(t, w.WriteStringLE("hello, world"))
+	assert.NoError(t, w.Flush())
+
+	r := NewBitReader(&buf)
+	b, err := r.ReadBool()
+	assert.NoError(t, err)
+	assert.True(t, b)
+	i, err := r.ReadInt64LE(11)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-300), i)
+	bi, err := r.ReadBigIntLE(100)
+	assert.NoError(t, err)
+	assert.Equal(t, wide.String(), bi.String())
+	bu, err := r.ReadBigUintLE(70)
+	assert.NoError(t, err)
+	assert.Equal(t, "1193046", bu.String())
+	f32, err := r.ReadFloat32LE()
+	assert.NoError(t, err)
+	assert.Equal(t, float32(3.25), f32)
+	f64, err := r.ReadFloat64LE()
+	assert.NoError(t, err)
+	assert.Equal(t, -1.0e100, f64)
+	s, err := r.ReadStringLE()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world", s)
+}
@@ -0,0 +1,57 @@
+package lib
+
+import "context"
+
+// Message is implemented by every generated struct, union and enum
+type Message interface {
+	MarshalBits(w *BitWriter) error
+	UnmarshalBits(r *BitReader) error
+}
+
+// Invoker sends the request of an rpc to a service and decodes the response it waits for
+type Invoker interface {
+	Invoke(ctx context.Context, svc uint32, ord uint64, req Message, resp Message) error
+	// Open starts a streaming rpc, the stream is abandoned once ctx is done
+	Open(ctx context.Context, svc uint32, ord uint64) (Stream, error)
+}
+
+// Handler decodes the request of an rpc by its ord and returns the response of the service, generated dispatchers implement this
+type Handler interface {
+	Handle(ctx context.Context, ord uint64, r *BitReader) (Message, error)
+}
+
+// StreamHandler handles the streaming rpcs of a service by their ord, generated dispatchers implement this when a service has any
+// the stream is ended once it returns, with the error it returns if there is one
+type StreamHandler interface {
+	HandleStream(ctx context.Context, ord uint64, s Stream) error
+}
+
+// Stream carries the messages of a streaming rpc in both directions
+type Stream interface {
+	// Send encodes a message to the peer
+	Send(m Message) error
+	// Recv decodes the next message from the peer into m, returning io.EOF once the peer has ended the stream
+	Recv(m Message) error
+	// CloseSend tells the peer that nothing more will be sent, messages can still be received
+	CloseSend() error
+}
+
+// TypedStream sends messages of type S and receives messages of type R, generated code adapts a stream to the typed interface of an rpc with this
+type TypedStream[S Message, R any, P interface {
+	*R
+	Message
+}] struct {
+	Stream
+}
+
+func (s TypedStream[S, R, P]) Send(m S) error {
+	return s.Stream.Send(m)
+}
+
+func (s TypedStream[S, R, P]) Recv() (*R, error) {
+	m := P(new(R))
+	if err := s.Stream.Recv(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
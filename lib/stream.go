@@ -0,0 +1,301 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MaxQueued bounds the bytes either side buffers for a stream before it is read, a peer that sends faster than the other side reads fails the stream
+const MaxQueued = MaxPayload
+
+// headerBytes is the size of a frame header, which every frame queued counts along with its payload
+const headerBytes = (KindBits + ServiceBits + OrdBits + ReqIdBits + PayloadBits + 7) / 8
+
+var ErrStreamOverflow = errors.New("stream received more than it has read")
+
+// queue buffers the frames received for a stream, so a slow reader never holds up the other requests of a connection
+type queue struct {
+	mu     sync.Mutex
+	frames []Frame
+	size   int           // the bytes of the frames queued
+	limit  int           // the most bytes queued at once, unbounded if 0
+	ready  chan struct{} // signalled whenever a frame is pushed
+}
+
+func newQueue(limit int) *queue {
+	return &queue{limit: limit, ready: make(chan struct{}, 1)}
+}
+
+// push queues a frame, returning false without queuing it if the queue would exceed its limit
+// a frame is always queued when the queue is empty, so the largest payload still fits
+func (q *queue) push(f Frame) bool {
+	size := headerBytes + len(f.Payload)
+	q.mu.Lock()
+	if q.limit > 0 && len(q.frames) > 0 && q.size+size > q.limit {
+		q.mu.Unlock()
+		return false
+	}
+	q.frames = append(q.frames, f)
+	q.size += size
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *queue) tryPop() (Frame, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.frames) == 0 {
+		return Frame{}, false
+	}
+	f := q.frames[0]
+	q.frames = q.frames[1:]
+	q.size -= headerBytes + len(f.Payload)
+	return f, true
+}
+
+// pop waits for the next frame, returning false once ctx is done or once done is closed and every frame pushed before it was popped
+func (q *queue) pop(ctx context.Context, done <-chan struct{}) (Frame, bool) {
+	for {
+		if ctx.Err() != nil {
+			return Frame{}, false
+		}
+		if f, ok := q.tryPop(); ok {
+			return f, true
+		}
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+		case <-done:
+			f, ok := q.tryPop()
+			return f, ok
+		}
+	}
+}
+
+// head is the frame that opened a stream, whose ids every later frame of the stream carries
+type head Frame
+
+func (h head) frame(kind FrameKind, payload []byte) Frame {
+	return Frame{Kind: kind, Service: h.Service, Ord: h.Ord, ReqId: h.ReqId, Payload: payload}
+}
+
+func (h head) send(c *conn, m Message) error {
+	payload, err := encodeMessage(m)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(h.frame(MessageFrameKind, payload))
+}
+
+// serverStream is the side of a stream handled by the server, its context is cancelled when the client abandons the stream
+// or sends more than MaxQueued bytes ahead of the handler
+type serverStream struct {
+	head
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	c      *conn
+	q      *queue
+
+	mu         sync.Mutex
+	recvEnded  bool
+	sendClosed bool
+}
+
+var _ Stream = (*serverStream)(nil)
+
+func newServerStream(ctx context.Context, c *conn, f Frame) *serverStream {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &serverStream{head: head(f), ctx: ctx, cancel: cancel, c: c, q: newQueue(MaxQueued)}
+}
+
+// receive queues a frame sent by the client, failing the stream if the handler has fallen too far behind reading them
+func (st *serverStream) receive(f Frame) {
+	if !st.q.push(f) {
+		st.cancel(ErrStreamOverflow)
+	}
+}
+
+func (st *serverStream) Send(m Message) error {
+	if err := st.ctx.Err(); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	closed := st.sendClosed
+	st.mu.Unlock()
+	if closed {
+		return ErrSendClosed
+	}
+	return st.send(st.c, m)
+}
+
+func (st *serverStream) Recv(m Message) error {
+	st.mu.Lock()
+	ended := st.recvEnded
+	st.mu.Unlock()
+	if ended {
+		return io.EOF
+	}
+
+	f, ok := st.q.pop(st.ctx, nil)
+	if !ok {
+		return context.Cause(st.ctx)
+	}
+	if f.Kind == EndFrameKind {
+		st.mu.Lock()
+		st.recvEnded = true
+		st.mu.Unlock()
+		return io.EOF
+	}
+	return m.UnmarshalBits(NewBitReader(bytes.NewReader(f.Payload)))
+}
+
+// CloseSend ends the call for the client, which the server does once the handler returns
+func (st *serverStream) CloseSend() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sendClosed {
+		return nil
+	}
+	st.sendClosed = true
+	return st.c.writeFrame(st.frame(EndFrameKind, nil))
+}
+
+// clientStream is the side of a stream opened by the client, its context is cancelled when the server sends more than MaxQueued bytes
+// ahead of the reader, and with the error of the stream once the server ends it
+type clientStream struct {
+	head
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	c      *Client
+	q      *queue
+	stop   func() bool // stops watching ctx once the stream has ended
+
+	mu         sync.Mutex
+	sendClosed bool
+	err        error // io.EOF or the error of the server once the server has ended the stream
+}
+
+var _ Stream = (*clientStream)(nil)
+
+// Open sends the frame that starts a streaming rpc, frames the server sends back are queued for the stream until it ends
+// if ctx is done before then, the server is told to abandon the stream
+func (c *Client) Open(ctx context.Context, svc uint32, ord uint64) (Stream, error) {
+	if ord >= 1<<OrdBits {
+		return nil, ErrFrameOrd
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	st := &clientStream{head: head{Service: svc, Ord: ord}, ctx: ctx, cancel: cancel, c: c, q: newQueue(MaxQueued)}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextId++
+	st.ReqId = c.nextId
+	c.streams[st.ReqId] = st
+	c.mu.Unlock()
+
+	if err := c.c.writeFrame(st.frame(OpenFrameKind, nil)); err != nil {
+		c.unregisterStream(st.ReqId)
+		cancel(err)
+		return nil, err
+	}
+	st.stop = context.AfterFunc(ctx, st.abort)
+	return st, nil
+}
+
+// unregisterStream stops queuing frames for a stream, returning whether it was still open
+func (c *Client) unregisterStream(reqId uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.streams[reqId]
+	delete(c.streams, reqId)
+	return ok
+}
+
+// receive queues a frame sent by the server, failing the stream if the reader has fallen too far behind reading them
+func (st *clientStream) receive(f Frame) {
+	if !st.q.push(f) {
+		st.cancel(ErrStreamOverflow)
+	}
+}
+
+// abort tells the server to stop handling the stream, unless the server has already ended it
+func (st *clientStream) abort() {
+	if st.c.unregisterStream(st.ReqId) {
+		// a failed write means the connection is broken, which the read loop will observe
+		_ = st.c.c.writeFrame(st.frame(CancelFrameKind, nil))
+	}
+}
+
+func (st *clientStream) Send(m Message) error {
+	if st.ctx.Err() != nil {
+		return context.Cause(st.ctx)
+	}
+	st.mu.Lock()
+	closed := st.sendClosed
+	st.mu.Unlock()
+	if closed {
+		return ErrSendClosed
+	}
+	return st.send(st.c.c, m)
+}
+
+func (st *clientStream) Recv(m Message) error {
+	st.mu.Lock()
+	err := st.err
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f, ok := st.q.pop(st.ctx, st.c.done)
+	if !ok {
+		if st.ctx.Err() != nil {
+			return context.Cause(st.ctx)
+		}
+		st.c.mu.Lock()
+		defer st.c.mu.Unlock()
+		return st.c.err
+	}
+
+	switch f.Kind {
+	case MessageFrameKind:
+		return m.UnmarshalBits(NewBitReader(bytes.NewReader(f.Payload)))
+	case EndFrameKind:
+		return st.end(io.EOF)
+	case ErrorFrameKind:
+		return st.end(decodeErr(f.Payload))
+	default:
+		return st.end(fmt.Errorf("unexpected %s frame in a stream", f.Kind))
+	}
+}
+
+// end records the error every later call to Recv and Send returns, the server has already forgotten the stream
+func (st *clientStream) end(err error) error {
+	st.stop()
+	st.cancel(err)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.err = err
+	return err
+}
+
+func (st *clientStream) CloseSend() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.sendClosed {
+		return nil
+	}
+	st.sendClosed = true
+	return st.c.c.writeFrame(st.frame(EndFrameKind, nil))
+}
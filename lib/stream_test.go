@@ -0,0 +1,254 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStreamSvc = 0xBEEF
+
+type testStreamHandler struct {
+	testHandler
+	cancelled chan struct{}
+}
+
+func (h *testStreamHandler) HandleStream(ctx context.Context, ord uint64, s Stream) error {
+	switch ord {
+	case 1:
+		// count down from the request
+		var req testMsg
+		if err := s.Recv(&req); err != nil {
+			return err
+		}
+		for n := req.n; n > 0; n-- {
+			if err := s.Send(&testMsg{n: n}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case 2:
+		// sum the requests
+		var sum int64
+		for {
+			var req testMsg
+			err := s.Recv(&req)
+			if errors.Is(err, io.EOF) {
+				return s.Send(&testMsg{n: sum})
+			}
+			if err != nil {
+				return err
+			}
+			sum += req.n
+		}
+	case 3:
+		// double each request as it arrives
+		for {
+			var req testMsg
+			err := s.Recv(&req)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.Send(&testMsg{n: req.n * 2}); err != nil {
+				return err
+			}
+		}
+	case 4:
+		if err := s.Send(&testMsg{n: 1}); err != nil {
+			return err
+		}
+		return errors.New("failed midway")
+	case 5:
+		// send until the client abandons the stream
+		for ctx.Err() == nil {
+			if err := s.Send(&testMsg{n: 1}); err != nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		close(h.cancelled)
+		return ctx.Err()
+	case 7:
+		panic("bad stream")
+	}
+	return &OrdErr{Type: "Test", Ord: ord}
+}
+
+func runTestStreams(t *testing.T) (*testStreamHandler, *Client) {
+	server, client := runTestServer(t)
+	h := &testStreamHandler{cancelled: make(chan struct{})}
+	server.Register(testStreamSvc, h)
+	return h, client
+}
+
+func recvAll(s Stream) ([]int64, error) {
+	var ns []int64
+	for {
+		var resp testMsg
+		if err := s.Recv(&resp); err != nil {
+			return ns, err
+		}
+		ns = append(ns, resp.n)
+	}
+}
+
+func TestStream_Server(t *testing.T) {
+	_, client := runTestStreams(t)
+
+	s, err := client.Open(context.Background(), testStreamSvc, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Send(&testMsg{n: 3}))
+	assert.NoError(t, s.CloseSend())
+	assert.ErrorIs(t, s.Send(&testMsg{n: 3}), ErrSendClosed)
+
+	ns, err := recvAll(s)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []int64{3, 2, 1}, ns)
+
+	// an ended stream keeps reporting its end
+	assert.ErrorIs(t, s.Recv(&testMsg{}), io.EOF)
+}
+
+func TestStream_Client(t *testing.T) {
+	_, client := runTestStreams(t)
+
+	s, err := client.Open(context.Background(), testStreamSvc, 2)
+	assert.NoError(t, err)
+	for i := range 5 {
+		assert.NoError(t, s.Send(&testMsg{n: int64(i)}))
+	}
+	assert.NoError(t, s.CloseSend())
+
+	ns, err := recvAll(s)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []int64{10}, ns)
+}
+
+func TestStream_Bidirectional(t *testing.T) {
+	_, client := runTestStreams(t)
+
+	s, err := client.Open(context.Background(), testStreamSvc, 3)
+	assert.NoError(t, err)
+	for i := range 3 {
+		assert.NoError(t, s.Send(&testMsg{n: int64(i)}))
+		var resp testMsg
+		assert.NoError(t, s.Recv(&resp))
+		assert.Equal(t, int64(2*i), resp.n)
+	}
+	assert.NoError(t, s.CloseSend())
+	assert.ErrorIs(t, s.Recv(&testMsg{}), io.EOF)
+}
+
+func TestStream_Errors(t *testing.T) {
+	_, client := runTestStreams(t)
+	ctx := context.Background()
+
+	// messages sent before the error are still received
+	s, err := client.Open(ctx, testStreamSvc, 4)
+	assert.NoError(t, err)
+	ns, err := recvAll(s)
+	assert.Equal(t, []int64{1}, ns)
+	assert.Equal(t, &RemoteErr{Msg: "failed midway"}, err)
+	// sending to a stream the server has ended reports how it ended
+	assert.Equal(t, &RemoteErr{Msg: "failed midway"}, s.Send(&testMsg{}))
+
+	s, err = client.Open(ctx, testStreamSvc, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, &RemoteErr{Msg: "Test: unknown ord '@6'"}, s.Recv(&testMsg{}))
+
+	s, err = client.Open(ctx, testStreamSvc, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, &RemoteErr{Msg: "handler panicked: bad stream"}, s.Recv(&testMsg{}))
+
+	// the unary handler of the service does not stream
+	s, err = client.Open(ctx, testSvc, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &RemoteErr{Msg: "service does not stream: 0xcafe"}, s.Recv(&testMsg{}))
+
+	_, err = client.Open(ctx, testStreamSvc, 1<<OrdBits)
+	assert.ErrorIs(t, err, ErrFrameOrd)
+}
+
+func TestStream_Cancel(t *testing.T) {
+	h, client := runTestStreams(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := client.Open(ctx, testStreamSvc, 5)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Recv(&testMsg{}))
+
+	cancel()
+	assert.ErrorIs(t, s.Recv(&testMsg{}), context.Canceled)
+	assert.ErrorIs(t, s.Send(&testMsg{}), context.Canceled)
+
+	select {
+	case <-h.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the server did not observe the cancellation")
+	}
+
+	// the connection is still usable after a stream is abandoned
+	var resp testMsg
+	assert.NoError(t, client.Invoke(context.Background(), testSvc, 1, &testMsg{n: 4}, &resp))
+	assert.Equal(t, int64(8), resp.n)
+}
+
+func TestStream_ClientClose(t *testing.T) {
+	_, client := runTestStreams(t)
+
+	s, err := client.Open(context.Background(), testStreamSvc, 3)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Close())
+	assert.ErrorIs(t, s.Recv(&testMsg{}), ErrClosed)
+
+	_, err = client.Open(context.Background(), testStreamSvc, 3)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestStream_Overflow(t *testing.T) {
+	st := newServerStream(context.Background(), nil, Frame{Kind: OpenFrameKind})
+	payload := make([]byte, MaxQueued/2)
+
+	// frames are queued until the handler falls too far behind reading them
+	st.receive(Frame{Kind: MessageFrameKind, Payload: payload})
+	assert.NoError(t, st.ctx.Err())
+	st.receive(Frame{Kind: MessageFrameKind, Payload: payload})
+	assert.ErrorIs(t, st.Recv(&testMsg{}), ErrStreamOverflow)
+
+	// a single frame fits however large its payload
+	q := newQueue(MaxQueued)
+	assert.True(t, q.push(Frame{Payload: make([]byte, MaxQueued)}))
+	assert.False(t, q.push(Frame{}))
+	_, ok := q.tryPop()
+	assert.True(t, ok)
+	assert.True(t, q.push(Frame{}))
+}
+
+func TestStream_ClientOverflow(t *testing.T) {
+	h, client := runTestStreams(t)
+
+	s, err := client.Open(context.Background(), testStreamSvc, 5)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Recv(&testMsg{}))
+
+	// the server is told to abandon a stream the client has fallen too far behind reading
+	st := s.(*clientStream)
+	payload := make([]byte, MaxQueued/2)
+	st.receive(Frame{Kind: MessageFrameKind, Payload: payload})
+	st.receive(Frame{Kind: MessageFrameKind, Payload: payload})
+	assert.ErrorIs(t, s.Recv(&testMsg{}), ErrStreamOverflow)
+	assert.ErrorIs(t, s.Send(&testMsg{}), ErrStreamOverflow)
+
+	select {
+	case <-h.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the server did not observe the cancellation")
+	}
+}